@@ -1,35 +1,19 @@
 package keystore
 
 import (
-	"encoding/json"
-	"fmt"
-	"os"
-	"time"
-
-	"github.com/ethereum/go-ethereum/crypto"
-
-	//"io/ioutil"
-	//    "github.com/pborman/uuid"
 	"encoding/hex"
 	"errors"
-	"io/ioutil"
+	"fmt"
+	"os"
+	"strings"
 	"sync"
-
-	//    "strconv"
-	"crypto/sha256"
-
-	"golang.org/x/crypto/pbkdf2"
+	"time"
+	"unicode/utf8"
 )
 
 type CrackerParams struct {
-	key_version string
-	key_v1      *encryptedKeyJSONV1
-	key_v3      *encryptedKeyJSONV3
-
-	// for presale
-	iv         []byte
-	cipherText []byte
-	EthAddr    string
+	Targets []*Target // not solved yet
+	Solved  []*Target
 
 	V          int // Verbosity
 	Start_from int
@@ -44,81 +28,7 @@ type CrackerParams struct {
 
 var mutex = &sync.Mutex{}
 
-func LoadPresaleFile(params *CrackerParams, path string) error {
-
-	preSaleKeyStruct := struct {
-		EncSeed string
-		EthAddr string
-		Email   string
-		BtcAddr string
-	}{}
-
-	keyFileContent, err := ioutil.ReadFile(path)
-	if err != nil {
-		return err
-	}
-
-	params.key_version = "presale"
-
-	err = json.Unmarshal(keyFileContent, &preSaleKeyStruct)
-	if err != nil {
-		return err
-	}
-
-	params.EthAddr = preSaleKeyStruct.EthAddr
-
-	encSeedBytes, err := hex.DecodeString(preSaleKeyStruct.EncSeed)
-	params.iv = encSeedBytes[:16]
-	params.cipherText = encSeedBytes[16:]
-
-	println("Key file version:", params.key_version)
-	return nil
-}
-
-func LoadKeyFile(params *CrackerParams, path string, log_level int) error {
-
-	keyFileContent, err := ioutil.ReadFile(path)
-	if err != nil {
-		return err
-	}
-
-	//    println( "Private key file content:", string( keyFileContent ) )
-
-	params.key_version = "v3"
-	params.key_v3, err = LoadKeyVersion3(keyFileContent)
-
-	if err != nil {
-		params.key_version = "v1"
-		params.key_v1, err = LoadKeyVersion1(keyFileContent)
-		if err != nil {
-			return err
-		}
-		//println( "Private key JSON (version 1):", string( pk_log ) )
-	} else {
-		//println( "Private key JSON (version 3):", string( pk_log ) )
-	}
-
-	if log_level > 0 {
-		println("Key file version:", params.key_version)
-	}
-	return nil
-}
-
-func LoadKeyVersion1(fileContent []byte) (*encryptedKeyJSONV1, error) {
-	key := new(encryptedKeyJSONV1)
-	err := json.Unmarshal(fileContent, key)
-	return key, err
-}
-
-func LoadKeyVersion3(fileContent []byte) (*encryptedKeyJSONV3, error) {
-	key := new(encryptedKeyJSONV3)
-	err := json.Unmarshal(fileContent, key)
-	return key, err
-}
-
 func Test_pass(params *CrackerParams, s string, thread int) error {
-	var err error
-
 	mutex.Lock()
 	params.N++
 	if params.V > 0 {
@@ -154,82 +64,81 @@ func Test_pass(params *CrackerParams, s string, thread int) error {
 			}
 		}
 	}
+	targets := params.Targets
 	mutex.Unlock()
 	if params.N+params.Skipped < params.Start_from {
 		return errors.New("skipped")
 	}
 
-	var addr string
-	var pk []byte
-	switch params.key_version {
-	case "v3":
-		err, addr, pk = Test_pass_v3(params.key_v3, s)
-	case "v1":
-		err, addr, pk = Test_pass_v1(params.key_v1, s)
-	case "presale":
-		err, addr, pk = Test_pass_presale(params, s)
+	// the same password may open several files, check them all
+	err := errors.New("no targets")
+	solved := false
+	for _, t := range targets {
+		found, e := t.Verifier.Check(s)
+		if e != nil {
+			err = e
+			continue
+		}
+		solve(params, t, s, found)
+		solved = true
 	}
 
-	if err == nil {
-		println("")
-		println("")
-		println("-------------------------------------------------------------------------")
-		println("              CONGRATULATIONS !!! WE FOUND YOUR PASSWORD !!!")
-		println("-------------------------------------------------------------------------")
-		println("")
-		println("   Password:", s)
-		println("    Address:", addr)
-		println("Private Key:", hex.EncodeToString(pk))
-		println("")
-		println("          Do not forget to donate some ETH to the developer:")
-		println("     Ethereum Address: 0x281694Fabfdd9735e01bB59942B18c469b6e3df6")
-		println("-------------------------------------------------------------------------")
-		println("")
-		println("")
-		os.Exit(0)
+	if solved {
+		return nil
 	}
-
 	return err
 }
 
-func Test_pass_v1(k *encryptedKeyJSONV1, auth string) (error, string, []byte) {
-	pk, _, err := decryptKeyV1(k, auth)
-	return err, k.Address, pk
-}
-
-func Test_pass_v3(k *encryptedKeyJSONV3, auth string) (error, string, []byte) {
-	pk, _, err := decryptKeyV3(k, auth)
-	return err, k.Address, pk
-}
+// solve reports the found password and removes the target, the run is over
+// when no targets are left.
+func solve(params *CrackerParams, t *Target, s string, found *Found) {
+	mutex.Lock()
+	defer mutex.Unlock()
 
-func Test_pass_presale(params *CrackerParams, password string) (error, string, []byte) {
-	passBytes := []byte(password)
-	derivedKey := pbkdf2.Key(passBytes, passBytes, 2000, 16, sha256.New)
-	//	_, err := aesCBCDecrypt(derivedKey, params.cipherText, params.iv)
+	i := 0
+	for i < len(params.Targets) && params.Targets[i] != t {
+		i++
+	}
+	if i == len(params.Targets) {
+		return // solved by another thread
+	}
 
-	plainText, err := aesCBCDecrypt(derivedKey, params.cipherText, params.iv)
-	if err != nil {
-		return err, "", nil
+	// a new slice, the threads may still be iterating over the old one
+	params.Targets = append(params.Targets[:i:i], params.Targets[i+1:]...)
+	params.Solved = append(params.Solved, t)
+	t.Password = s
+
+	println("")
+	println("")
+	println("-------------------------------------------------------------------------")
+	println("              CONGRATULATIONS !!! WE FOUND YOUR PASSWORD !!!")
+	println("-------------------------------------------------------------------------")
+	println("")
+	println("   Key file:", t.Path)
+	println("   Password:", s)
+	if !utf8.ValidString(s) || strings.TrimSpace(s) != s {
+		println("  Bytes hex:", hex.EncodeToString([]byte(s)))
+	}
+	println("    Address:", found.Address)
+	if found.PrivateKey != nil {
+		println("Private Key:", hex.EncodeToString(found.PrivateKey))
 	}
-	ethPriv := crypto.Keccak256(plainText) // Sha3(plainText)
-	ecKey, err := crypto.ToECDSA(ethPriv)
-	if err != nil {
-		return err, "", nil
+	for _, n := range found.Extra {
+		println(n)
 	}
-	//	key = &Key {
-	//		Id:         nil,
-	//		Address:    PubkeyToAddress( ecKey.PublicKey),
-	//		PrivateKey: ecKey,
-	//	}
-
-	Address := crypto.PubkeyToAddress(ecKey.PublicKey)
-
-	//	derivedAddr := hex.EncodeToString(key.Address.Bytes()) // needed because .Hex() gives leading "0x"
-	derivedAddr := hex.EncodeToString(Address.Bytes()) // needed because .Hex() gives leading "0x"
-	expectedAddr := params.EthAddr
-	if derivedAddr != expectedAddr {
-		err = fmt.Errorf("decrypted addr '%s' not equal to expected addr '%s'", derivedAddr, expectedAddr)
+	println("")
+
+	if len(params.Targets) > 0 {
+		println("   Key files left to crack:", len(params.Targets))
+		println("-------------------------------------------------------------------------")
+		println("")
+		return
 	}
 
-	return err, derivedAddr, ethPriv
+	println("          Do not forget to donate some ETH to the developer:")
+	println("     Ethereum Address: 0x281694Fabfdd9735e01bB59942B18c469b6e3df6")
+	println("-------------------------------------------------------------------------")
+	println("")
+	println("")
+	os.Exit(0)
 }
@@ -0,0 +1,130 @@
+package keystore
+
+import (
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/lexansoft/ethcracker/accounts"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/text/unicode/norm"
+)
+
+// mnemonicSeed returns the BIP39 seed of the mnemonic and the passphrase.
+func mnemonicSeed(mnemonic, passphrase string) []byte {
+	return pbkdf2.Key([]byte(norm.NFKD.String(mnemonic)), []byte("mnemonic"+norm.NFKD.String(passphrase)), 2048, 64, sha512.New)
+}
+
+var errHDKey = errors.New("invalid BIP32 key")
+
+// hdKey is a BIP32 extended private key.
+type hdKey struct {
+	key   []byte
+	chain []byte
+}
+
+func newHDKey(i []byte) (*hdKey, error) {
+	k := new(big.Int).SetBytes(i[:32])
+	if k.Sign() == 0 || k.Cmp(crypto.S256().Params().N) >= 0 {
+		return nil, errHDKey
+	}
+	return &hdKey{key: i[:32], chain: i[32:]}, nil
+}
+
+// masterKey returns the BIP32 master key of the seed.
+func masterKey(seed []byte) (*hdKey, error) {
+	m := hmac.New(sha512.New, []byte("Bitcoin seed"))
+	m.Write(seed)
+	return newHDKey(m.Sum(nil))
+}
+
+// child returns the child key i, hardened if i >= 0x80000000.
+func (k *hdKey) child(i uint32) (*hdKey, error) {
+	var data []byte
+	if i >= 0x80000000 {
+		data = append([]byte{0}, k.key...)
+	} else {
+		priv, err := crypto.ToECDSA(k.key)
+		if err != nil {
+			return nil, err
+		}
+		data = crypto.CompressPubkey(&priv.PublicKey)
+	}
+	data = binary.BigEndian.AppendUint32(data, i)
+
+	m := hmac.New(sha512.New, k.chain)
+	m.Write(data)
+
+	c, err := newHDKey(m.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+
+	n := crypto.S256().Params().N
+	key := new(big.Int).SetBytes(c.key)
+	key.Add(key, new(big.Int).SetBytes(k.key))
+	key.Mod(key, n)
+	if key.Sign() == 0 {
+		return nil, errHDKey
+	}
+	c.key = key.FillBytes(make([]byte, 32))
+
+	return c, nil
+}
+
+// derive returns the key at the path below k.
+func (k *hdKey) derive(path accounts.DerivationPath) (*hdKey, error) {
+	var err error
+	for _, i := range path {
+		if k, err = k.child(i); err != nil {
+			return nil, err
+		}
+	}
+	return k, nil
+}
+
+// ecdsa returns the private key.
+func (k *hdKey) ecdsa() (*ecdsa.PrivateKey, error) {
+	return crypto.ToECDSA(k.key)
+}
+
+// hdAccount is one account derived from the seed.
+type hdAccount struct {
+	path accounts.DerivationPath
+	key  *ecdsa.PrivateKey
+}
+
+// deriveAccounts returns the first n accounts below the base path, like
+// MetaMask and the hardware wallets number them.
+func deriveAccounts(seed []byte, base accounts.DerivationPath, n int) ([]hdAccount, error) {
+	m, err := masterKey(seed)
+	if err != nil {
+		return nil, err
+	}
+
+	parent, err := m.derive(base)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]hdAccount, 0, n)
+	for i := 0; i < n; i++ {
+		c, err := parent.child(uint32(i))
+		if err != nil {
+			return nil, err
+		}
+		key, err := c.ecdsa()
+		if err != nil {
+			return nil, err
+		}
+
+		path := append(append(accounts.DerivationPath{}, base...), uint32(i))
+		res = append(res, hdAccount{path: path, key: key})
+	}
+
+	return res, nil
+}
@@ -0,0 +1,36 @@
+package keystore
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/lexansoft/ethcracker/accounts"
+)
+
+const testMnemonic = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+
+func TestMnemonicSeed(t *testing.T) {
+	// the test vector of BIP39
+	want := "c55257c360c07c72029aebc1b53c05ed0362ada38ead3e3e9efa3708e53495531f09a6987599d18264c1e1c92f2cf141630c7a3c4ab7c81b2f001698e7463b04"
+	if seed := hex.EncodeToString(mnemonicSeed(testMnemonic, "TREZOR")); seed != want {
+		t.Errorf("seed %s, want %s", seed, want)
+	}
+}
+
+func TestDeriveAccounts(t *testing.T) {
+	accs, err := deriveAccounts(mnemonicSeed(testMnemonic, ""), accounts.DefaultBaseDerivationPath, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"0x9858EfFD232B4033E47d90003D41EC34EcaEda94",
+		"0x6Fac4D18c912343BF86fa7049364Dd4E424Ab9C0",
+	}
+	for i, a := range accs {
+		if addr := crypto.PubkeyToAddress(a.key.PublicKey).Hex(); addr != want[i] {
+			t.Errorf("account %s: address %s, want %s", a.path, addr, want[i])
+		}
+	}
+}
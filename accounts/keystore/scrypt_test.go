@@ -0,0 +1,52 @@
+package keystore
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// the test vectors of RFC 7914
+var scryptTests = []struct {
+	password, salt string
+	N, r, p        int
+	key            string
+}{
+	{"", "", 16, 1, 1, "77d6576238657b203b19ca42c18a0497f16b4844e3074ae8dfdffa3fede21442fcd0069ded0948f8326a753a0fc81f17e8d3e0fb2e0d3628cf35e20c38d18906"},
+	{"password", "NaCl", 1024, 8, 16, "fdbabe1c9d3472007856e7190d01e9fe7c6ad7cbc8237830e77376634b3731622eaf30d92e22a3886ff109279d9830dac727afb94a83ee6d8360cbdfa2cc0640"},
+	{"pleaseletmein", "SodiumChloride", 16384, 8, 1, "7023bdcb3afd7348461c06cd81fd38ebfda8fbba904f8e3ea9b543f6545da1f2d5432955613f0fcf62d49705242a9af9e61e85dc0d651e40dfcf017b45575887"},
+}
+
+func TestScryptKey(t *testing.T) {
+	// twice, to run on the scratch memory left by the other parameters
+	for round := 0; round < 2; round++ {
+		for _, test := range scryptTests {
+			key, err := scryptKey([]byte(test.password), []byte(test.salt), test.N, test.r, test.p, 64)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hex.EncodeToString(key) != test.key {
+				t.Errorf("%q, N=%d: key %x, want %s", test.password, test.N, key, test.key)
+			}
+		}
+	}
+
+	if _, err := scryptKey([]byte("p"), []byte("s"), 1000, 8, 1, 32); err == nil {
+		t.Error("N not a power of 2 accepted")
+	}
+}
+
+func BenchmarkScryptKeyStandard(b *testing.B) {
+	pass := []byte("password")
+	for i := 0; i < b.N; i++ {
+		scryptKey(pass, pass, StandardScryptN, scryptR, StandardScryptP, scryptDKLen)
+	}
+}
+
+func BenchmarkScryptKeyStandardGeneric(b *testing.B) {
+	pass := []byte("password")
+	for i := 0; i < b.N; i++ {
+		scrypt.Key(pass, pass, StandardScryptN, scryptR, StandardScryptP, scryptDKLen)
+	}
+}
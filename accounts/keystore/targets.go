@@ -0,0 +1,109 @@
+package keystore
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Target is one wallet file to crack.
+type Target struct {
+	Path     string
+	Address  string // from the keystore directory, if known before cracking
+	Verifier Verifier
+
+	Password string // when solved
+}
+
+// LoadTargets loads the wallet files. A directory adds every key file in it,
+// skipping the files of unknown format, while a file of unknown format named
+// directly is an error.
+func LoadTargets(format string, paths []string) ([]*Target, error) {
+	targets := make([]*Target, 0, len(paths))
+	seen := make(map[string]bool)
+
+	add := func(path string) error {
+		path = filepath.Clean(path)
+		if seen[path] {
+			return nil
+		}
+		seen[path] = true
+
+		v, err := LoadVerifier(format, path)
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		targets = append(targets, &Target{Path: path, Verifier: v})
+		return nil
+	}
+
+	for _, path := range paths {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if !fi.IsDir() {
+			if err := add(path); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		files, err := ioutil.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, fi := range files {
+			if skipKeyFile(fi) {
+				continue
+			}
+			if err := add(filepath.Join(path, fi.Name())); err != nil {
+				fmt.Println("Skipping", err)
+			}
+		}
+	}
+
+	if len(targets) == 0 {
+		return nil, errors.New("no key files found")
+	}
+
+	return targets, nil
+}
+
+// LoadKeystore loads every account of the keystore directory, finding them
+// the same way geth does.
+func LoadKeystore(format string, dir string) ([]*Target, error) {
+	ac, _ := newAccountCache(dir)
+
+	accs, err := ac.scan()
+	if err != nil {
+		return nil, err
+	}
+
+	targets := make([]*Target, 0, len(accs))
+	for _, a := range accs {
+		v, err := LoadVerifier(format, a.URL.Path)
+		if err != nil {
+			fmt.Println("Skipping", a.URL.Path+":", err)
+			continue
+		}
+		targets = append(targets, &Target{Path: a.URL.Path, Address: a.Address.Hex(), Verifier: v})
+	}
+
+	if len(targets) == 0 {
+		return nil, errors.New("no accounts found in " + dir)
+	}
+
+	return targets, nil
+}
+
+// String returns the address and the file of the target
+func (t *Target) String() string {
+	if t.Address == "" {
+		return t.Path
+	}
+	return t.Address + " ( " + t.Path + " )"
+}
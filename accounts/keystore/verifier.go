@@ -0,0 +1,108 @@
+package keystore
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Verifier checks the passwords against one wallet file format. A new format
+// lives in its own file and is registered in the init() below.
+type Verifier interface {
+	// Load reads the wallet file.
+	Load(path string) error
+	// Check tries the password, and returns what it opens if it is correct.
+	// It is called from several threads at once.
+	Check(password string) (*Found, error)
+	// Describe returns the short description of the loaded wallet.
+	Describe() string
+}
+
+// MemoryUser is a Verifier which needs much memory for every Check, like
+// scrypt does.
+type MemoryUser interface {
+	// Memory returns the bytes one Check needs.
+	Memory() int
+}
+
+// MemoryPerThread returns the bytes one thread needs to check the targets.
+func MemoryPerThread(targets []*Target) int {
+	m := 0
+	for _, t := range targets {
+		if u, ok := t.Verifier.(MemoryUser); ok && u.Memory() > m {
+			m = u.Memory()
+		}
+	}
+	return m
+}
+
+// Found is what the correct password opens.
+type Found struct {
+	Address    string
+	PrivateKey []byte
+	Extra      []string // more lines to report, f.e. the seed phrase
+}
+
+type verifierFormat struct {
+	name string
+	new  func() Verifier
+}
+
+var formats []verifierFormat
+
+// the built-in formats, in the order of the detection: the strict formats
+// first, the MetaMask vault scan accepts almost any file with a vault inside
+func init() {
+	RegisterVerifier("v3", func() Verifier { return new(v3Verifier) })
+	RegisterVerifier("v1", func() Verifier { return new(v1Verifier) })
+	RegisterVerifier("presale", func() Verifier { return new(presaleVerifier) })
+	RegisterVerifier("metamask", func() Verifier { return new(metamaskVerifier) })
+	RegisterVerifier("mew", func() Verifier { return new(mewVerifier) })
+	RegisterVerifier("bip39", func() Verifier { return new(bip39Verifier) })
+}
+
+// RegisterVerifier adds the wallet format. The formats are detected in the
+// order of the registration.
+func RegisterVerifier(name string, new func() Verifier) {
+	for _, f := range formats {
+		if f.name == name {
+			panic("verifier already registered: " + name)
+		}
+	}
+	formats = append(formats, verifierFormat{name, new})
+}
+
+// VerifierNames returns the names of the registered formats.
+func VerifierNames() []string {
+	names := make([]string, len(formats))
+	for i, f := range formats {
+		names[i] = f.name
+	}
+	return names
+}
+
+// LoadVerifier loads the wallet file with the format, or, if the format is
+// empty, with the first registered format which accepts the file.
+func LoadVerifier(format string, path string) (Verifier, error) {
+	if format != "" {
+		for _, f := range formats {
+			if f.name == format {
+				v := f.new()
+				return v, v.Load(path)
+			}
+		}
+		return nil, fmt.Errorf("unknown wallet format %q, known: %s", format, strings.Join(VerifierNames(), ", "))
+	}
+
+	errs := make([]string, 0, len(formats))
+	for _, f := range formats {
+		v := f.new()
+		err := v.Load(path)
+		if err == nil {
+			return v, nil
+		}
+		errs = append(errs, f.name+": "+err.Error())
+	}
+
+	return nil, errors.New("unknown wallet file format ( " + strings.Join(errs, "; ") + " )")
+}
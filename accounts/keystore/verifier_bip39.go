@@ -0,0 +1,129 @@
+package keystore
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/lexansoft/ethcracker/accounts"
+)
+
+// bip39DefaultPath is the first account of the default base path, the first
+// address of MetaMask, Ledger Live and Trezor
+var bip39DefaultPath = append(append(accounts.DerivationPath{}, accounts.DefaultBaseDerivationPath...), 0)
+
+// bip39Verifier checks the BIP39 passphrases ( the "25th word" ) of the known
+// mnemonic. The file has the mnemonic, the address and optionally the comma
+// separated derivation paths, one per line.
+type bip39Verifier struct {
+	mnemonic string
+	address  []byte
+	paths    []accounts.DerivationPath
+}
+
+// parseMnemonicFile reads the mnemonic, the address and the optional paths
+func parseMnemonicFile(path string) (mnemonic string, address string, paths []accounts.DerivationPath, err error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	lines := make([]string, 0, 3)
+	for _, l := range strings.Split(string(content), "\n") {
+		if l = strings.TrimSpace(l); l != "" {
+			lines = append(lines, l)
+		}
+	}
+	if len(lines) < 2 || len(lines) > 3 {
+		return "", "", nil, errors.New("expected the mnemonic, the address and the derivation path")
+	}
+
+	words := strings.Fields(lines[0])
+	if len(words) < 12 || len(words) > 24 || len(words)%3 != 0 {
+		return "", "", nil, fmt.Errorf("%d words in the mnemonic", len(words))
+	}
+
+	paths = []accounts.DerivationPath{bip39DefaultPath}
+	if len(lines) == 3 {
+		paths = paths[:0]
+		for _, p := range strings.Split(lines[2], ",") {
+			dpath, err := accounts.ParseDerivationPath(p)
+			if err != nil {
+				return "", "", nil, err
+			}
+			paths = append(paths, dpath)
+		}
+	}
+
+	return strings.Join(words, " "), lines[1], paths, nil
+}
+
+// findAccount derives the accounts of the seed along the paths, and returns
+// the first one matching
+func findAccount(seed []byte, paths []accounts.DerivationPath, match func(addr []byte) bool) (*Found, error) {
+	m, err := masterKey(seed)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range paths {
+		k, err := m.derive(p)
+		if err != nil {
+			continue
+		}
+		key, err := k.ecdsa()
+		if err != nil {
+			continue
+		}
+
+		addr := crypto.PubkeyToAddress(key.PublicKey).Bytes()
+		if match(addr) {
+			return &Found{Address: hex.EncodeToString(addr), PrivateKey: k.key, Extra: []string{"       Path: " + p.String()}}, nil
+		}
+	}
+
+	return nil, ErrDecrypt
+}
+
+func (v *bip39Verifier) Load(path string) error {
+	mnemonic, address, paths, err := parseMnemonicFile(path)
+	if err != nil {
+		return err
+	}
+
+	if strings.Contains(mnemonic, "?") {
+		return errors.New("unknown words in the mnemonic")
+	}
+	if !common.IsHexAddress(address) {
+		return errors.New("invalid address " + address)
+	}
+
+	v.mnemonic = mnemonic
+	v.address = common.HexToAddress(address).Bytes()
+	v.paths = paths
+
+	return nil
+}
+
+func (v *bip39Verifier) Check(passphrase string) (*Found, error) {
+	return findAccount(mnemonicSeed(v.mnemonic, passphrase), v.paths, func(addr []byte) bool {
+		return bytes.Equal(addr, v.address)
+	})
+}
+
+func (v *bip39Verifier) Describe() string {
+	return fmt.Sprintf("BIP39 passphrase of %d words mnemonic, address %x at %s", len(strings.Fields(v.mnemonic)), v.address, pathsString(v.paths))
+}
+
+func pathsString(paths []accounts.DerivationPath) string {
+	s := make([]string, len(paths))
+	for i, p := range paths {
+		s[i] = p.String()
+	}
+	return strings.Join(s, ", ")
+}
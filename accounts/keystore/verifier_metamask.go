@@ -0,0 +1,242 @@
+package keystore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/lexansoft/ethcracker/accounts"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// the iterations of the vaults before keyMetadata
+const metamaskDefaultIterations = 10000
+
+// metamaskVerifier checks the passwords of the MetaMask extension vault: the
+// vault JSON itself, or the LevelDB log of the extension storage with the
+// vault somewhere inside.
+type metamaskVerifier struct {
+	data       []byte
+	iv         []byte
+	salt       []byte
+	iterations int
+}
+
+type metamaskVault struct {
+	Data        string `json:"data"`
+	IV          string `json:"iv"`
+	Salt        string `json:"salt"`
+	KeyMetadata struct {
+		Algorithm string `json:"algorithm"`
+		Params    struct {
+			Iterations int `json:"iterations"`
+		} `json:"params"`
+	} `json:"keyMetadata"`
+}
+
+// the vault fields, also in the JSON escaped into a string as the LevelDB logs
+// keep it
+var (
+	metamaskData       = regexp.MustCompile(`\\*"data\\*"\s*:\s*\\*"([A-Za-z0-9+/=]+)\\*"`)
+	metamaskIV         = regexp.MustCompile(`\\*"iv\\*"\s*:\s*\\*"([A-Za-z0-9+/=]+)\\*"`)
+	metamaskSalt       = regexp.MustCompile(`\\*"salt\\*"\s*:\s*\\*"([A-Za-z0-9+/=]+)\\*"`)
+	metamaskIterations = regexp.MustCompile(`\\*"iterations\\*"\s*:\s*([0-9]+)`)
+)
+
+// findMetamaskVault returns the last vault in the text, the newest one in a
+// LevelDB log.
+func findMetamaskVault(content []byte) (*metamaskVault, error) {
+	all := metamaskData.FindAllSubmatchIndex(content, -1)
+	if len(all) == 0 {
+		return nil, errors.New("no vault data")
+	}
+	last := all[len(all)-1]
+
+	// the other fields are next to the data
+	from, to := last[0]-1000, last[1]+1000
+	if from < 0 {
+		from = 0
+	}
+	if to > len(content) {
+		to = len(content)
+	}
+	near := content[from:to]
+
+	vault := &metamaskVault{Data: string(content[last[2]:last[3]])}
+
+	if m := metamaskIV.FindSubmatch(near); m != nil {
+		vault.IV = string(m[1])
+	}
+	if m := metamaskSalt.FindSubmatch(near); m != nil {
+		vault.Salt = string(m[1])
+	}
+	if m := metamaskIterations.FindSubmatch(near); m != nil {
+		vault.KeyMetadata.Params.Iterations, _ = strconv.Atoi(string(m[1]))
+	}
+
+	return vault, nil
+}
+
+func (v *metamaskVerifier) Load(path string) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	vault := new(metamaskVault)
+	if err := json.Unmarshal(content, vault); err != nil || vault.Data == "" {
+		if vault, err = findMetamaskVault(content); err != nil {
+			return err
+		}
+	}
+
+	if vault.KeyMetadata.Algorithm != "" && vault.KeyMetadata.Algorithm != "PBKDF2" {
+		return fmt.Errorf("unsupported key derivation %s", vault.KeyMetadata.Algorithm)
+	}
+
+	if v.data, err = base64.StdEncoding.DecodeString(vault.Data); err != nil {
+		return errors.New("invalid base64 in data")
+	}
+	if v.iv, err = base64.StdEncoding.DecodeString(vault.IV); err != nil || len(v.iv) == 0 {
+		return errors.New("no iv")
+	}
+	if v.salt, err = base64.StdEncoding.DecodeString(vault.Salt); err != nil || len(v.salt) == 0 {
+		return errors.New("no salt")
+	}
+
+	v.iterations = vault.KeyMetadata.Params.Iterations
+	if v.iterations == 0 {
+		v.iterations = metamaskDefaultIterations
+	}
+
+	return nil
+}
+
+// the keyrings in the decrypted vault
+type metamaskKeyring struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+type metamaskHDKeyring struct {
+	Mnemonic         json.RawMessage `json:"mnemonic"` // a string, or the bytes of it
+	NumberOfAccounts int             `json:"numberOfAccounts"`
+	HDPath           string          `json:"hdPath"`
+}
+
+func (v *metamaskVerifier) Check(password string) (*Found, error) {
+	key := pbkdf2.Key([]byte(password), v.salt, v.iterations, 32, sha256.New)
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCMWithNonceSize(block, len(v.iv))
+	if err != nil {
+		return nil, err
+	}
+	plainText, err := gcm.Open(nil, v.iv, v.data, nil)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+
+	found := new(Found)
+
+	var keyrings []metamaskKeyring
+	if err := json.Unmarshal(plainText, &keyrings); err != nil {
+		// the password is right anyway, show what is there
+		found.Extra = append(found.Extra, "      Vault: "+string(plainText))
+		return found, nil
+	}
+
+	for _, kr := range keyrings {
+		switch kr.Type {
+		case "HD Key Tree":
+			v.hdKeyring(kr.Data, found)
+
+		case "Simple Key Pair":
+			var keys []string
+			json.Unmarshal(kr.Data, &keys)
+
+			for _, k := range keys {
+				priv, err := crypto.HexToECDSA(k)
+				if err != nil {
+					found.Extra = append(found.Extra, "Imported key: "+k)
+					continue
+				}
+				v.account(found, "Imported account:", priv.D.FillBytes(make([]byte, 32)), crypto.PubkeyToAddress(priv.PublicKey).Bytes())
+			}
+
+		default:
+			found.Extra = append(found.Extra, "    Keyring: "+kr.Type+" "+string(kr.Data))
+		}
+	}
+
+	return found, nil
+}
+
+// hdKeyring reports the seed phrase and the accounts derived from it
+func (v *metamaskVerifier) hdKeyring(data json.RawMessage, found *Found) {
+	var kr metamaskHDKeyring
+	json.Unmarshal(data, &kr)
+
+	var mnemonic string
+	if json.Unmarshal(kr.Mnemonic, &mnemonic) != nil {
+		var b []byte
+		var codes []int
+		json.Unmarshal(kr.Mnemonic, &codes)
+		for _, c := range codes {
+			b = append(b, byte(c))
+		}
+		mnemonic = string(b)
+	}
+
+	found.Extra = append(found.Extra, "Seed phrase: "+mnemonic)
+
+	base := accounts.DefaultBaseDerivationPath
+	if kr.HDPath != "" {
+		p, err := accounts.ParseDerivationPath(kr.HDPath)
+		if err != nil {
+			found.Extra = append(found.Extra, "    HD path: "+kr.HDPath+" "+err.Error())
+			return
+		}
+		base = p
+	}
+
+	n := kr.NumberOfAccounts
+	if n < 1 {
+		n = 1
+	}
+
+	accs, err := deriveAccounts(mnemonicSeed(mnemonic, ""), base, n)
+	if err != nil {
+		found.Extra = append(found.Extra, "    Accounts: "+err.Error())
+		return
+	}
+
+	for _, a := range accs {
+		v.account(found, "    Account: "+a.path.String(), a.key.D.FillBytes(make([]byte, 32)), crypto.PubkeyToAddress(a.key.PublicKey).Bytes())
+	}
+}
+
+// account reports the account, the first one is the address of the vault
+func (v *metamaskVerifier) account(found *Found, title string, priv, addr []byte) {
+	if found.Address == "" {
+		found.Address = hex.EncodeToString(addr)
+		found.PrivateKey = priv
+	}
+	found.Extra = append(found.Extra, title+" 0x"+hex.EncodeToString(addr)+" Private Key: "+hex.EncodeToString(priv))
+}
+
+func (v *metamaskVerifier) Describe() string {
+	return fmt.Sprintf("MetaMask vault, PBKDF2 %d iterations", v.iterations)
+}
@@ -0,0 +1,106 @@
+package keystore
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const opensslMagic = "Salted__"
+
+// mewVerifier checks the passwords of the "encrypted private key" of the early
+// MyEtherWallet and MyCrypto: the OpenSSL Salted__ blob in base64, and
+// optionally the expected address on the next line.
+type mewVerifier struct {
+	salt       []byte
+	cipherText []byte
+	address    string // lower case hex without 0x, empty if unknown
+}
+
+func (v *mewVerifier) Load(path string) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	lines := strings.Fields(string(content))
+	if len(lines) == 0 || len(lines) > 2 {
+		return errors.New("expected the base64 blob and the address")
+	}
+
+	blob, err := base64.StdEncoding.DecodeString(lines[0])
+	if err != nil {
+		return errors.New("invalid base64")
+	}
+	if !bytes.HasPrefix(blob, []byte(opensslMagic)) || len(blob) < 32 || len(blob)%16 != 0 {
+		return errors.New("no Salted__ header")
+	}
+
+	v.salt = blob[8:16]
+	v.cipherText = blob[16:]
+
+	if len(lines) == 2 {
+		if !common.IsHexAddress(lines[1]) {
+			return errors.New("invalid address " + lines[1])
+		}
+		v.address = hex.EncodeToString(common.HexToAddress(lines[1]).Bytes())
+	}
+
+	return nil
+}
+
+// evpBytesToKey is the OpenSSL EVP_BytesToKey with MD5 and one round, the key
+// derivation of "openssl enc" and CryptoJS.
+func evpBytesToKey(password, salt []byte, keyLen, ivLen int) ([]byte, []byte) {
+	var res, d []byte
+	for len(res) < keyLen+ivLen {
+		h := md5.New()
+		h.Write(d)
+		h.Write(password)
+		h.Write(salt)
+		d = h.Sum(nil)
+		res = append(res, d...)
+	}
+	return res[:keyLen], res[keyLen : keyLen+ivLen]
+}
+
+func (v *mewVerifier) Check(password string) (*Found, error) {
+	key, iv := evpBytesToKey([]byte(password), v.salt, 32, 16)
+
+	plainText, err := aesCBCDecrypt(key, v.cipherText, iv)
+	if err != nil {
+		return nil, err
+	}
+
+	// MEW encrypted the hex of the key, the padding alone passes 1 of 256
+	priv := strings.TrimPrefix(string(plainText), "0x")
+	if len(priv) != 64 {
+		return nil, ErrDecrypt
+	}
+	ecKey, err := crypto.HexToECDSA(priv)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+
+	addr := hex.EncodeToString(crypto.PubkeyToAddress(ecKey.PublicKey).Bytes())
+	if v.address != "" && addr != v.address {
+		return nil, fmt.Errorf("decrypted addr '%s' not equal to expected addr '%s'", addr, v.address)
+	}
+
+	return &Found{Address: addr, PrivateKey: crypto.FromECDSA(ecKey)}, nil
+}
+
+func (v *mewVerifier) Describe() string {
+	if v.address == "" {
+		return "MEW encrypted private key"
+	}
+	return "MEW encrypted private key of " + v.address
+}
@@ -0,0 +1,62 @@
+package keystore
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lexansoft/ethcracker/accounts"
+)
+
+// mnemonicVerifier checks the candidate mnemonics, not the passwords, against
+// the address or the first hex digits of it. It is not detected from the
+// file, the mnemonic recovery modes load it with LoadMnemonic.
+type mnemonicVerifier struct {
+	words  int
+	prefix string // lower case hex without 0x
+	paths  []accounts.DerivationPath
+}
+
+// LoadMnemonic loads the mnemonic recovery file: the mnemonic with the unknown
+// words, the address or the first hex digits of it, and optionally the comma
+// separated derivation paths, one per line. It returns the mnemonic to recover
+// and the target to check the candidates against.
+func LoadMnemonic(path string) (string, []*Target, error) {
+	mnemonic, address, paths, err := parseMnemonicFile(path)
+	if err != nil {
+		return "", nil, err
+	}
+
+	prefix := strings.ToLower(strings.TrimPrefix(strings.TrimPrefix(address, "0x"), "0X"))
+	if _, err := hex.DecodeString(prefix + strings.Repeat("0", len(prefix)%2)); err != nil || len(prefix) > 40 {
+		return "", nil, errors.New("invalid address " + address)
+	}
+	if len(prefix) < 6 {
+		fmt.Println("WARNING: with only", len(prefix), "hex digits of the address a wrong mnemonic may match")
+	}
+
+	v := &mnemonicVerifier{words: len(strings.Fields(mnemonic)), prefix: prefix, paths: paths}
+
+	return mnemonic, []*Target{{Path: path, Verifier: v}}, nil
+}
+
+func (v *mnemonicVerifier) Load(path string) error {
+	return errors.New("mnemonic targets are loaded with LoadMnemonic")
+}
+
+func (v *mnemonicVerifier) Check(mnemonic string) (*Found, error) {
+	found, err := findAccount(mnemonicSeed(mnemonic, ""), v.paths, func(addr []byte) bool {
+		return strings.HasPrefix(hex.EncodeToString(addr), v.prefix)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	found.Extra = append([]string{"   Mnemonic: " + mnemonic}, found.Extra...)
+	return found, nil
+}
+
+func (v *mnemonicVerifier) Describe() string {
+	return fmt.Sprintf("%d words mnemonic, address 0x%s at %s", v.words, v.prefix, pathsString(v.paths))
+}
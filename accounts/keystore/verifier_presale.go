@@ -0,0 +1,85 @@
+package keystore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// presaleVerifier checks the passwords of the Ethereum presale wallet JSON.
+type presaleVerifier struct {
+	iv         []byte
+	cipherText []byte
+	ethAddr    string
+}
+
+func (v *presaleVerifier) Load(path string) error {
+	preSaleKeyStruct := struct {
+		EncSeed string
+		EthAddr string
+		Email   string
+		BtcAddr string
+	}{}
+
+	keyFileContent, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(keyFileContent, &preSaleKeyStruct); err != nil {
+		return err
+	}
+
+	encSeedBytes, err := hex.DecodeString(preSaleKeyStruct.EncSeed)
+	if err != nil {
+		return errors.New("invalid hex in encseed")
+	}
+	if len(encSeedBytes) < 32 || len(encSeedBytes)%16 != 0 {
+		return errors.New("no encseed")
+	}
+
+	v.ethAddr = preSaleKeyStruct.EthAddr
+	v.iv = encSeedBytes[:16]
+	v.cipherText = encSeedBytes[16:]
+
+	return nil
+}
+
+func (v *presaleVerifier) Check(password string) (*Found, error) {
+	/*
+		See https://github.com/ethereum/pyethsaletool
+
+		pyethsaletool generates the encryption key from password by
+		2000 rounds of PBKDF2 with HMAC-SHA-256 using password as salt (:().
+		16 byte key length within PBKDF2 and resulting key is used as AES key
+	*/
+	passBytes := []byte(password)
+	derivedKey := pbkdf2.Key(passBytes, passBytes, 2000, 16, sha256.New)
+
+	plainText, err := aesCBCDecrypt(derivedKey, v.cipherText, v.iv)
+	if err != nil {
+		return nil, err
+	}
+	ethPriv := crypto.Keccak256(plainText)
+	ecKey, err := crypto.ToECDSA(ethPriv)
+	if err != nil {
+		return nil, err
+	}
+
+	derivedAddr := hex.EncodeToString(crypto.PubkeyToAddress(ecKey.PublicKey).Bytes()) // needed because .Hex() gives leading "0x"
+	if derivedAddr != v.ethAddr {
+		return nil, fmt.Errorf("decrypted addr '%s' not equal to expected addr '%s'", derivedAddr, v.ethAddr)
+	}
+
+	return &Found{Address: derivedAddr, PrivateKey: ethPriv}, nil
+}
+
+func (v *presaleVerifier) Describe() string {
+	return "presale wallet " + v.ethAddr
+}
@@ -0,0 +1,338 @@
+package keystore
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const presaleTestFile = "{\"encseed\": \"26d87f5f2bf9835f9a47eefae571bc09f9107bb13d54ff12a4ec095d01f83897494cf34f7bed2ed34126ecba9db7b62de56c9d7cd136520a0427bfb11b8954ba7ac39b90d4650d3448e31185affcd74226a68f1e94b1108e6e0a4a91cdd83eba\", \"ethaddr\": \"d4584b5f6229b7be90727b0fc8c6b91bb427821f\", \"email\": \"gustav.simonsson@gmail.com\", \"btcaddr\": \"1EVknXyFC68kKNLkh6YnKzW41svSRoaAcx\"}"
+
+func TestLoadVerifierDetect(t *testing.T) {
+	t.Parallel()
+
+	presale := filepath.Join(t.TempDir(), "presale.json")
+	if err := os.WriteFile(presale, []byte(presaleTestFile), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path, format, pass, addr string
+	}{
+		{"testdata/very-light-scrypt.json", "v3", "", "45dea0fb0bba44f4fcf290bba71fd57d7117cbb8"},
+		{"testdata/v1/cb61d5a9c4896fb9658090b597ef0e7be6f7b67e/cb61d5a9c4896fb9658090b597ef0e7be6f7b67e", "v1", "g", "cb61d5a9c4896fb9658090b597ef0e7be6f7b67e"},
+		{presale, "presale", "foo", "d4584b5f6229b7be90727b0fc8c6b91bb427821f"},
+	}
+
+	for _, test := range tests {
+		v, err := LoadVerifier("", test.path)
+		if err != nil {
+			t.Fatalf("%s: %v", test.path, err)
+		}
+		if _, err := LoadVerifier(test.format, test.path); err != nil {
+			t.Errorf("%s: not loaded as %s: %v", test.path, test.format, err)
+		}
+
+		found, err := v.Check(test.pass + "x")
+		if err == nil || found != nil {
+			t.Errorf("%s: wrong password accepted", test.path)
+		}
+
+		found, err = v.Check(test.pass)
+		if err != nil {
+			t.Fatalf("%s: %v", test.path, err)
+		}
+		if found.Address != test.addr {
+			t.Errorf("%s: wrong address %s, want %s", test.path, found.Address, test.addr)
+		}
+	}
+}
+
+func TestVerifierNames(t *testing.T) {
+	t.Parallel()
+
+	// the detection order documented in the README
+	want := "v3, v1, presale, metamask, mew, bip39"
+	if got := strings.Join(VerifierNames(), ", "); got != want {
+		t.Errorf("formats %s, want %s", got, want)
+	}
+}
+
+func TestLoadVerifierUnknown(t *testing.T) {
+	t.Parallel()
+
+	if _, err := LoadVerifier("", "testdata/v1_test_vector.json"); err == nil {
+		t.Error("test vector collection loaded as a key")
+	}
+	if _, err := LoadVerifier("nosuchformat", "testdata/very-light-scrypt.json"); err == nil {
+		t.Error("unknown format accepted")
+	}
+}
+
+func TestLoadTargetsDir(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"presale.json": presaleTestFile,
+		"garbage":      "not a key",
+		".hidden":      presaleTestFile,
+		"backup~":      presaleTestFile,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	targets, err := LoadTargets("", []string{dir, "testdata/very-light-scrypt.json", dir + "/presale.json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(targets) != 2 {
+		t.Fatalf("loaded %d targets, want 2", len(targets))
+	}
+	if targets[0].Path != filepath.Join(dir, "presale.json") || targets[1].Path != "testdata/very-light-scrypt.json" {
+		t.Errorf("wrong targets %s, %s", targets[0].Path, targets[1].Path)
+	}
+
+	if _, err := LoadTargets("", []string{filepath.Join(dir, "garbage")}); err == nil {
+		t.Error("garbage file loaded as a key")
+	}
+}
+
+func TestTestPassSharedPassword(t *testing.T) {
+	t.Parallel()
+
+	// two copies of the same key and one other, the run goes on while any is left
+	dir := t.TempDir()
+	for _, name := range []string{"a.json", "b.json"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(presaleTestFile), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	targets, err := LoadTargets("", []string{dir, "testdata/very-light-scrypt.json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(targets) != 3 {
+		t.Fatalf("loaded %d targets, want 3", len(targets))
+	}
+
+	params := &CrackerParams{Targets: targets, RE: 1}
+	if err := Test_pass(params, "bar", 0); err == nil {
+		t.Error("wrong password accepted")
+	}
+	if err := Test_pass(params, "foo", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(params.Solved) != 2 || len(params.Targets) != 1 {
+		t.Fatalf("solved %d, left %d, want 2 and 1", len(params.Solved), len(params.Targets))
+	}
+	for _, s := range params.Solved {
+		if s.Password != "foo" {
+			t.Errorf("%s: password %q, want foo", s.Path, s.Password)
+		}
+	}
+	if params.Targets[0].Path != "testdata/very-light-scrypt.json" {
+		t.Errorf("wrong target left %s", params.Targets[0].Path)
+	}
+}
+
+func TestLoadKeystore(t *testing.T) {
+	t.Parallel()
+
+	targets, err := LoadKeystore("", cachetestDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(targets) != len(cachetestAccounts) {
+		t.Fatalf("loaded %d accounts, want %d", len(targets), len(cachetestAccounts))
+	}
+	for i, a := range cachetestAccounts {
+		if targets[i].Address != a.Address.Hex() || targets[i].Path != a.URL.Path {
+			t.Errorf("wrong account %d: %s, want %s ( %s )", i, targets[i], a.Address.Hex(), a.URL.Path)
+		}
+	}
+
+	found, err := targets[0].Verifier.Check("foobar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if "0x"+found.Address != strings.ToLower(targets[0].Address) {
+		t.Errorf("wrong address %s, want %s", found.Address, targets[0].Address)
+	}
+}
+
+func TestMemoryPerThread(t *testing.T) {
+	t.Parallel()
+
+	targets, err := LoadTargets("", []string{
+		"testdata/very-light-scrypt.json",
+		"testdata/v1/cb61d5a9c4896fb9658090b597ef0e7be6f7b67e/cb61d5a9c4896fb9658090b597ef0e7be6f7b67e",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the v1 key has the standard scrypt parameters, N = 262144, r = 8, p = 1
+	if m, want := MemoryPerThread(targets), 128*262144*8+256*8+128*8; m != want {
+		t.Errorf("memory per thread %d, want %d", m, want)
+	}
+	if m := MemoryPerThread(targets[:1]); m != 128*2*8+256*8+128*8 {
+		t.Errorf("memory per thread of the light key %d", m)
+	}
+}
+
+func TestMetamaskVault(t *testing.T) {
+	t.Parallel()
+
+	vault, err := os.ReadFile("testdata/metamask-vault.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the vault as the LevelDB log of the extension keeps it
+	escaped, _ := json.Marshal(string(vault))
+	log := filepath.Join(t.TempDir(), "000003.log")
+	content := "\x00\x01garbage{\"KeyringController\":{\"vault\":" + string(escaped) + "}}\x00"
+	if err := os.WriteFile(log, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"testdata/metamask-vault.json", log} {
+		v, err := LoadVerifier("", path)
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		if _, err := v.Check("wrong horse"); err == nil {
+			t.Errorf("%s: wrong password accepted", path)
+		}
+
+		found, err := v.Check("correct horse")
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		if found.Address != "9858effd232b4033e47d90003d41ec34ecaeda94" {
+			t.Errorf("%s: wrong address %s", path, found.Address)
+		}
+		if len(found.Extra) != 4 || found.Extra[0] != "Seed phrase: "+testMnemonic {
+			t.Errorf("%s: wrong report %q", path, found.Extra)
+		}
+	}
+}
+
+func TestMEWEncryptedKey(t *testing.T) {
+	t.Parallel()
+
+	// made with: echo -n <private key> | openssl enc -aes-256-cbc -md md5 -base64 -A
+	v, err := LoadVerifier("", "testdata/mew-salted.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Describe() != "MEW encrypted private key of 2c7536e3605d9c16a7a3d7b1898e529396a65c23" {
+		t.Errorf("wrong description %s", v.Describe())
+	}
+	for _, pass := range []string{"", "testtes", "testtest "} {
+		if _, err := v.Check(pass); err == nil {
+			t.Errorf("wrong password %q accepted", pass)
+		}
+	}
+
+	found, err := v.Check("testtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(found.PrivateKey) != "4c0883a69102937d6231471b5dbb6204fe5129617082792ae468d01a3f362318" {
+		t.Errorf("wrong private key %x", found.PrivateKey)
+	}
+}
+
+func TestBIP39Passphrase(t *testing.T) {
+	t.Parallel()
+
+	v, err := LoadVerifier("", "testdata/bip39-passphrase.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.Check(""); err == nil {
+		t.Error("wrong passphrase accepted")
+	}
+	found, err := v.Check("TREZOR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.Address != "9c32f71d4db8fb9e1a58b0a80df79935e7256fa6" {
+		t.Errorf("wrong address %s", found.Address)
+	}
+
+	// the second account, without the passphrase
+	path := filepath.Join(t.TempDir(), "mnemonic.txt")
+	content := testMnemonic + "\n0x6Fac4D18c912343BF86fa7049364Dd4E424Ab9C0\nm/44'/60'/0'/0/1\n"
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if v, err = LoadVerifier("bip39", path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.Check(""); err != nil {
+		t.Errorf("empty passphrase not found: %v", err)
+	}
+}
+
+func TestLoadMnemonic(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "mnemonic.txt")
+	// the blank lines are skipped, the mnemonic is the first line with words
+	content := "\n  \nabandon abandon abandon ? abandon  abandon abandon abandon abandon abandon abandon abandn\n0x9858EfFD\n"
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	mnemonic, targets, err := LoadMnemonic(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mnemonic != "abandon abandon abandon ? abandon abandon abandon abandon abandon abandon abandon abandn" {
+		t.Errorf("wrong mnemonic %q", mnemonic)
+	}
+	v := targets[0].Verifier
+
+	if _, err := v.Check(testMnemonic + " abandon"); err == nil {
+		t.Error("wrong mnemonic accepted")
+	}
+	found, err := v.Check(testMnemonic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.Address != "9858effd232b4033e47d90003d41ec34ecaeda94" {
+		t.Errorf("wrong address %s", found.Address)
+	}
+
+	// the second account of the two paths
+	content = testMnemonic + "\n0x6Fac4D18\nm/44'/60'/0'/0/0, m/44'/60'/0'/0/1\n"
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, targets, err = LoadMnemonic(path); err != nil {
+		t.Fatal(err)
+	}
+	if found, err = targets[0].Verifier.Check(testMnemonic); err != nil {
+		t.Fatal(err)
+	}
+	if found.Extra[len(found.Extra)-1] != "       Path: m/44'/60'/0'/0/1" {
+		t.Errorf("wrong path %q", found.Extra)
+	}
+
+	if err := os.WriteFile(path, []byte(testMnemonic+"\n0x9858EfFZ\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := LoadMnemonic(path); err == nil {
+		t.Error("invalid address accepted")
+	}
+}
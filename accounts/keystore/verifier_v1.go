@@ -0,0 +1,46 @@
+package keystore
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+)
+
+// v1Verifier checks the passwords of the version 1 keystore files ( early geth ).
+type v1Verifier struct {
+	key *encryptedKeyJSONV1
+}
+
+func (v *v1Verifier) Load(path string) error {
+	keyFileContent, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	v.key = new(encryptedKeyJSONV1)
+	if err := json.Unmarshal(keyFileContent, v.key); err != nil {
+		return err
+	}
+
+	if v.key.Version != "1" {
+		return fmt.Errorf("version %q is not 1", v.key.Version)
+	}
+
+	return nil
+}
+
+func (v *v1Verifier) Check(password string) (*Found, error) {
+	pk, _, err := decryptKeyV1(v.key, password)
+	if err != nil {
+		return nil, err
+	}
+	return &Found{Address: v.key.Address, PrivateKey: pk}, nil
+}
+
+func (v *v1Verifier) Describe() string {
+	return fmt.Sprintf("v1 key %s, %s %v", v.key.Address, v.key.Crypto.KDF, kdfParams(v.key.Crypto))
+}
+
+func (v *v1Verifier) Memory() int {
+	return kdfMemory(v.key.Crypto)
+}
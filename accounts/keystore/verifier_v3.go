@@ -0,0 +1,78 @@
+package keystore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+// v3Verifier checks the passwords of the version 3 keystore files ( geth, Mist, MEW ).
+type v3Verifier struct {
+	key *encryptedKeyJSONV3
+}
+
+func (v *v3Verifier) Load(path string) error {
+	keyFileContent, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	v.key = new(encryptedKeyJSONV3)
+	if err := json.Unmarshal(keyFileContent, v.key); err != nil {
+		return err
+	}
+
+	if v.key.Version != version {
+		return fmt.Errorf("version %d is not %d", v.key.Version, version)
+	}
+	if v.key.Crypto.KDF == "" || v.key.Crypto.CipherText == "" {
+		return errors.New("no crypto section")
+	}
+
+	return nil
+}
+
+func (v *v3Verifier) Check(password string) (*Found, error) {
+	pk, _, err := decryptKeyV3(v.key, password)
+	if err != nil {
+		return nil, err
+	}
+	return &Found{Address: v.key.Address, PrivateKey: pk}, nil
+}
+
+func (v *v3Verifier) Describe() string {
+	return fmt.Sprintf("v3 key %s, %s %v", v.key.Address, v.key.Crypto.KDF, kdfParams(v.key.Crypto))
+}
+
+func (v *v3Verifier) Memory() int {
+	return kdfMemory(v.key.Crypto)
+}
+
+// kdfMemory returns the scratch memory of the scrypt KDF
+func kdfMemory(c CryptoJSON) int {
+	if c.KDF != keyHeaderKDF {
+		return 0
+	}
+
+	n, ok1 := c.KDFParams["n"].(float64)
+	r, ok2 := c.KDFParams["r"].(float64)
+	p, ok3 := c.KDFParams["p"].(float64)
+	if !ok1 || !ok2 || !ok3 {
+		return 0
+	}
+
+	// v, xy and the pbkdf2 output of scryptKey
+	return int(128*n*r + 256*r + 128*r*p)
+}
+
+// kdfParams returns the KDF parameters without the salt, for the description
+func kdfParams(c CryptoJSON) map[string]interface{} {
+	p := make(map[string]interface{})
+	for k, n := range c.KDFParams {
+		if k != "salt" {
+			p[k] = n
+		}
+	}
+	return p
+}
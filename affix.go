@@ -0,0 +1,56 @@
+package main
+
+// affixed wraps every variant of the generator with the common prefixes and
+// suffixes ( the variant itself goes first ).
+type affixed struct {
+	gen      generator
+	prefixes []string
+	suffixes []string
+}
+
+// with_empty returns the unique non-empty lines, after the empty one
+func with_empty(lines []string) []string {
+	res := []string{""}
+	seen := map[string]bool{"": true}
+
+	for _, n := range lines {
+		if !seen[n] {
+			seen[n] = true
+			res = append(res, n)
+		}
+	}
+
+	return res
+}
+
+func new_affixed(g generator, prefixes, suffixes []string) *affixed {
+	a := &affixed{gen: g, prefixes: with_empty(prefixes), suffixes: with_empty(suffixes)}
+
+	safe_mul(safe_mul(g.total(), len(a.prefixes)), len(a.suffixes))
+
+	return a
+}
+
+func (g *affixed) total() int {
+	return g.gen.total() * len(g.prefixes) * len(g.suffixes)
+}
+
+func (g *affixed) at(i int) string {
+	n := len(g.prefixes) * len(g.suffixes)
+	r := i % n
+
+	return g.prefixes[r/len(g.suffixes)] + g.gen.at(i/n) + g.suffixes[r%len(g.suffixes)]
+}
+
+// at_max skips the whole runs of the variant too long without any affix
+func (g *affixed) at_max(i, max int) (string, int) {
+	n := len(g.prefixes) * len(g.suffixes)
+	r := i % n
+
+	s, k := at_max(g.gen, i/n, max)
+	if k > 0 {
+		return "", k*n - r
+	}
+
+	return g.prefixes[r/len(g.suffixes)] + s + g.suffixes[r%len(g.suffixes)], 0
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// dump_file is one output stream of the -dump pipeline: the file (or stdout),
+// an optional compressor on top of it and a buffer on top of everything.
+type dump_file struct {
+	f *os.File
+	c io.WriteCloser
+	w *bufio.Writer
+}
+
+// dumper writes the variants into one or several (-dump_shards) streams,
+// distributing the records round-robin.
+type dumper struct {
+	files []*dump_file
+	sep   byte
+	n     int
+}
+
+// dump_shard_name inserts the shard number before the extensions of the path,
+// so "v.txt.gz" becomes "v-0.txt.gz", "v-1.txt.gz"...
+func dump_shard_name(path string, shard int) string {
+	dir, base := filepath.Split(path)
+
+	ext := ""
+	if i := strings.Index(base, "."); i > 0 {
+		base, ext = base[:i], base[i:]
+	}
+
+	return dir + base + "-" + strconv.Itoa(shard) + ext
+}
+
+// dump_compression returns the compression requested with -dump_compress,
+// or guessed from the extension of the dump file.
+func dump_compression(path string) string {
+	if *dump_compress != "" {
+		return *dump_compress
+	}
+
+	switch {
+	case strings.HasSuffix(path, ".gz"):
+		return "gzip"
+	case strings.HasSuffix(path, ".zst"):
+		return "zstd"
+	}
+
+	return "none"
+}
+
+func open_dump_file(path string, compression string) (*dump_file, error) {
+	var err error
+
+	df := &dump_file{}
+
+	if path == "-" {
+		df.f = os.Stdout
+	} else {
+		df.f, err = os.Create(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var w io.Writer = df.f
+
+	switch compression {
+	case "none":
+	case "gzip":
+		df.c = gzip.NewWriter(df.f)
+		w = df.c
+	case "zstd":
+		df.c, err = zstd.NewWriter(df.f)
+		if err != nil {
+			return nil, err
+		}
+		w = df.c
+	default:
+		panic("Wrong -dump_compress: " + compression)
+	}
+
+	df.w = bufio.NewWriterSize(w, 1<<16)
+
+	return df, nil
+}
+
+func (df *dump_file) close() error {
+	if err := df.w.Flush(); err != nil {
+		return err
+	}
+
+	if df.c != nil {
+		if err := df.c.Close(); err != nil {
+			return err
+		}
+	}
+
+	if df.f != os.Stdout {
+		return df.f.Close()
+	}
+
+	return nil
+}
+
+func new_dumper(path string) (*dumper, error) {
+	if *dump_shards < 1 {
+		panic("Wrong -dump_shards")
+	}
+
+	if path == "-" && *dump_shards > 1 {
+		panic("Can not split the stdout dump into shards")
+	}
+
+	d := &dumper{sep: '\n'}
+	if *dump_nul {
+		d.sep = 0
+	}
+
+	compression := dump_compression(path)
+
+	for i := 0; i < *dump_shards; i++ {
+		name := path
+		if *dump_shards > 1 {
+			name = dump_shard_name(path, i)
+		}
+
+		df, err := open_dump_file(name, compression)
+		if err != nil {
+			return nil, err
+		}
+
+		d.files = append(d.files, df)
+	}
+
+	return d, nil
+}
+
+func (d *dumper) write(s string) error {
+	w := d.files[d.n%len(d.files)].w
+	d.n++
+
+	if _, err := w.WriteString(s); err != nil {
+		return err
+	}
+
+	return w.WriteByte(d.sep)
+}
+
+func (d *dumper) close() error {
+	var err error
+
+	for _, df := range d.files {
+		if e := df.close(); e != nil && err == nil {
+			err = e
+		}
+	}
+
+	return err
+}
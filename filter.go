@@ -0,0 +1,254 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// policies are the password rules of the wallets which created the keys
+var policies = map[string]string{
+	"mew":      "len >= 9", // MyEtherWallet, MyCrypto
+	"mist":     "len >= 8", // Mist, Ethereum Wallet
+	"metamask": "len >= 8", // MetaMask
+	"parity":   "len >= 1", // Parity ( any non-empty password )
+	"strong":   "len >= 8 && hasUpper && hasLower && hasDigit",
+}
+
+// pass_info is what the filter expression knows about the variant
+type pass_info struct {
+	counts map[string]int
+}
+
+func new_pass_info(s string) *pass_info {
+	c := map[string]int{"len": len([]rune(s))}
+
+	for _, r := range s {
+		switch {
+		case unicode.IsUpper(r):
+			c["upper"]++
+		case unicode.IsLower(r):
+			c["lower"]++
+		case unicode.IsDigit(r):
+			c["digits"]++
+		case unicode.IsSpace(r):
+			c["spaces"]++
+		default:
+			c["symbols"]++
+		}
+
+		if r > unicode.MaxASCII {
+			c["nonASCII"]++
+		}
+	}
+
+	c["hasUpper"] = min(c["upper"], 1)
+	c["hasLower"] = min(c["lower"], 1)
+	c["hasDigit"] = min(c["digits"], 1)
+	c["hasSpace"] = min(c["spaces"], 1)
+	c["hasSymbol"] = min(c["symbols"], 1)
+	c["hasNonASCII"] = min(c["nonASCII"], 1)
+
+	return &pass_info{counts: c}
+}
+
+// filter_expr is a compiled -filter expression, the booleans are 0 and 1
+type filter_expr func(p *pass_info) int
+
+var filter_idents = []string{
+	"len", "upper", "lower", "digits", "spaces", "symbols", "nonASCII",
+	"hasUpper", "hasLower", "hasDigit", "hasSpace", "hasSymbol", "hasNonASCII",
+}
+
+type filter_parser struct {
+	tokens []string
+	pos    int
+}
+
+func tokenize_filter(s string) ([]string, error) {
+	tokens := make([]string, 0)
+
+	for i := 0; i < len(s); {
+		c := s[i]
+
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case strings.HasPrefix(s[i:], "&&") || strings.HasPrefix(s[i:], "||") ||
+			strings.HasPrefix(s[i:], "==") || strings.HasPrefix(s[i:], "!=") ||
+			strings.HasPrefix(s[i:], "<=") || strings.HasPrefix(s[i:], ">="):
+			tokens = append(tokens, s[i:i+2])
+			i += 2
+		case strings.IndexByte("!()<>", c) >= 0:
+			tokens = append(tokens, s[i:i+1])
+			i++
+		case c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			j := i
+			for j < len(s) && (s[j] >= '0' && s[j] <= '9' || s[j] >= 'a' && s[j] <= 'z' || s[j] >= 'A' && s[j] <= 'Z') {
+				j++
+			}
+			tokens = append(tokens, s[i:j])
+			i = j
+		default:
+			return nil, errors.New("wrong character in the filter: " + s[i:i+1])
+		}
+	}
+
+	return tokens, nil
+}
+
+// new_filter compiles the expression like "len>=9 && hasUpper && !hasSpace"
+func new_filter(s string) (filter_expr, error) {
+	tokens, err := tokenize_filter(s)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &filter_parser{tokens: tokens}
+
+	e, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.pos < len(p.tokens) {
+		return nil, errors.New("unexpected " + p.tokens[p.pos] + " in the filter")
+	}
+
+	return e, nil
+}
+
+func (p *filter_parser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func bool_int(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func (p *filter_parser) or() (filter_expr, error) {
+	a, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek() == "||" {
+		p.pos++
+
+		b, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+
+		l := a
+		a = func(x *pass_info) int { return bool_int(l(x) != 0 || b(x) != 0) }
+	}
+
+	return a, nil
+}
+
+func (p *filter_parser) and() (filter_expr, error) {
+	a, err := p.cmp()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek() == "&&" {
+		p.pos++
+
+		b, err := p.cmp()
+		if err != nil {
+			return nil, err
+		}
+
+		l := a
+		a = func(x *pass_info) int { return bool_int(l(x) != 0 && b(x) != 0) }
+	}
+
+	return a, nil
+}
+
+func (p *filter_parser) cmp() (filter_expr, error) {
+	a, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+
+	op := p.peek()
+
+	var f func(a, b int) bool
+	switch op {
+	case "==":
+		f = func(a, b int) bool { return a == b }
+	case "!=":
+		f = func(a, b int) bool { return a != b }
+	case "<":
+		f = func(a, b int) bool { return a < b }
+	case "<=":
+		f = func(a, b int) bool { return a <= b }
+	case ">":
+		f = func(a, b int) bool { return a > b }
+	case ">=":
+		f = func(a, b int) bool { return a >= b }
+	default:
+		return a, nil
+	}
+	p.pos++
+
+	b, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+
+	return func(x *pass_info) int { return bool_int(f(a(x), b(x))) }, nil
+}
+
+func (p *filter_parser) unary() (filter_expr, error) {
+	t := p.peek()
+	p.pos++
+
+	switch {
+	case t == "":
+		return nil, errors.New("unexpected end of the filter")
+
+	case t == "!":
+		a, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return func(x *pass_info) int { return bool_int(a(x) == 0) }, nil
+
+	case t == "(":
+		a, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, errors.New("missing ) in the filter")
+		}
+		p.pos++
+		return a, nil
+
+	case t[0] >= '0' && t[0] <= '9':
+		n, err := strconv.Atoi(t)
+		if err != nil {
+			return nil, errors.New("wrong number in the filter: " + t)
+		}
+		return func(x *pass_info) int { return n }, nil
+	}
+
+	for _, id := range filter_idents {
+		if id == t {
+			return func(x *pass_info) int { return x.counts[t] }, nil
+		}
+	}
+
+	return nil, errors.New("unknown name in the filter: " + t)
+}
@@ -5,7 +5,9 @@ package main
 import (
 	"bufio"
 	"flag"
+	"math"
 	"os"
+	"runtime"
 	"strconv"
 	"strings"
 	"sync"
@@ -23,35 +25,74 @@ var templates [][]string
 type TEMP_FLAGS struct {
 	UseAlways  bool
 	Capitalize bool
+	Keep       bool        // keep the line in its place
+	Permute    bool        // permute the line even with -keep_order
+	Repeat     int         // up to N tokens of the line in one variant ( ~rN, ~RN )
+	Same       bool        // the same token can be repeated ( ~RN )
+	Name       string      // ~#name, to refer to the line from the others
+	Conds      []TEMP_COND // ~?name, ~?!name, ~?name=token
+}
+
+// TEMP_COND is a condition for using a template line: the named line is used
+// ( with the given token, if any ) or, with Not, is not used.
+type TEMP_COND struct {
+	Line  string
+	Token string
+	Not   bool
 }
 
 var templates_flags []TEMP_FLAGS
 
 // note, that variables are pointers
-var pk = flag.String("pk", "", "Private key file")
+var pk = flag.String("pk", "", "Private key file, or comma separated files and directories")
+var keystore_dir = flag.String("keystore", "", "Crack all the accounts of the keystore directory")
 var t = flag.String("t", "", "Pattern file")
 var l = flag.String("l", "", "File with list of variants. If specified, -t is ignored")
+var l_flags = flag.String("l_flags", "", "Template line flags to apply to every variant of -l ( f.e. ~c )")
+var mask_flag = flag.String("mask", "", "The password with unknown characters marked as ? or [abc]. If specified, -t is ignored")
+var mnemonic_flag = flag.String("mnemonic", "", "File with the mnemonic with the unknown ( ? ) or misspelled words, and the address ( see below ). If specified, -t is ignored")
+var mnemonic_order = flag.Bool("mnemonic_order", false, "The -mnemonic words are all known, but scrambled: try all the orders of them")
+var wordlist = flag.String("wordlist", "", "BIP39 wordlist of -mnemonic ( default: detect )")
+var near = flag.String("near", "", "File with almost correct passwords ( one per line ) to try the variants around. If specified, -t is ignored")
+var near_dist = flag.Int("near_dist", 1, "Maximum number of edits ( insert, delete, replace, swap ) for -near")
+var prince_flag = flag.String("prince", "", "Wordlist to chain the words from ( PRINCE ). If specified, -t is ignored")
+var prince_elems = flag.Int("prince_elems", 4, "Maximum number of words in one -prince variant")
+var prince_min_elem = flag.Int("prince_min_elem", 1, "Minimum length of a -prince word")
+var prince_max_elem = flag.Int("prince_max_elem", 16, "Maximum length of a -prince word")
+var mask_charset = flag.String("mask_charset", "", "Characters to try for ? in the mask ( default: all printable ASCII )")
 var min_len = flag.Int("min_len", 8, "Minimum password length")
 var max_len = flag.Int("max_len", 20, "Maximum password length")
-var n_threads = flag.Int("threads", 4, "Number of threads")
+var threads_flag = flag.String("threads", "4", "Number of threads, or auto to pick it by the CPUs and the memory")
 var pre_sale = flag.Bool("presale", false, "The key file is the presale JSON")
+var key_format = flag.String("format", "", "Format of the key file: "+strings.Join(keystore.VerifierNames(), ", ")+" ( default: detect )")
 var keep_order = flag.Bool("keep_order", false, "Keep order of the lines (no permutations)")
+var near_order = flag.Int("near_order", -1, "Allow at most N adjacent swaps from the order of the lines ( -1: any order )")
 var v = flag.Int("v", 1, "Verbosity ( 0, 1, 2 )")
 var re = flag.Int("re", 1, "Report every N-th combination")
 var start_from = flag.String("start_from", "0", "Skip first N combinations")
-var dump = flag.String("dump", "", "Just output all the possible variants")
+var prefixes = flag.String("prefixes", "", "File with the prefixes to add to every variant ( one per line )")
+var suffixes = flag.String("suffixes", "", "File with the suffixes to add to every variant ( one per line )")
+var filter_flag = flag.String("filter", "", "Try only the variants matching the expression ( f.e. \"len>=9 && hasUpper && !hasSpace\" )")
+var policy = flag.String("policy", "", "Try only the variants allowed by the wallet: mew, mist, metamask, parity, strong")
+var ws = flag.Bool("ws", false, "Also try every variant with the common leading/trailing spaces and new lines")
+var enc = flag.String("enc", "", "Also try every variant in the encodings: nfc, nfd, cp1251, cp1252, latin1, utf16le ( comma separated )")
+var order = flag.String("order", "seq", "Order of the variants: seq, random ( every variant once, in the pseudorandom order )")
+var order_key = flag.String("order_key", "", "Key of the -order random, different keys give different orders")
+var shard_flag = flag.String("shard", "", "Try only the i-th of n equal parts of the variants ( i/n, f.e. 2/5 )")
+var dump = flag.String("dump", "", "Just output all the possible variants ( - for stdout )")
+var dump_compress = flag.String("dump_compress", "", "Compress the dump: none, gzip, zstd ( default: by the file extension )")
+var dump_nul = flag.Bool("dump_nul", false, "Separate the dumped variants with NUL instead of new line")
+var dump_shards = flag.Int("dump_shards", 1, "Split the dump into N files")
 
 var params keystore.CrackerParams
+var n_threads int
 var chans []chan string
 var wg sync.WaitGroup
-var f_dump *os.File
-
-func fact(x int) int {
-	if x == 0 {
-		return 1
-	}
-	return x * fact(x-1)
-}
+var f_dump *dumper
+var filter filter_expr
+var skipped_by = make(map[string]int)
+var gen generator
+var checksum func(s string) bool
 
 func safe_add(a []string, s string) []string {
 	for _, n := range a {
@@ -68,31 +109,48 @@ func main() {
 
 	flag.Parse()
 
+	if *l != "" || *mnemonic_flag != "" || *mask_flag != "" || *near != "" {
+		// the list ( or the mask, which fixes the length anyway, or the
+		// remembered passwords ) is tried as is, unless the length limits are
+		// given explicitly
+		len_set := false
+		flag.Visit(func(f *flag.Flag) {
+			len_set = len_set || f.Name == "min_len" || f.Name == "max_len"
+		})
+
+		if !len_set {
+			*min_len = 0
+			*max_len = math.MaxInt32
+		}
+	}
+
 	if *dump != "" {
 		*v = 0
-		*n_threads = 1
+		*threads_flag = "1"
 
-		f_dump, err = os.Create(*dump)
+		f_dump, err = new_dumper(*dump)
 		if err != nil {
 			panic(err)
 		}
-
-		defer f_dump.Close()
 	}
 
 	if *v > 0 {
 		println("------------------------------------------------")
-		println("Ethereum Password Cracker v2.16 ")
+		println("Ethereum Password Cracker v2.17 ")
 		println("Author: @AlexNa ")
 		println("------------------------------------------------")
 		println("Private Key File:", *pk)
+		if *keystore_dir != "" {
+			println("Keystore:", *keystore_dir)
+		}
 		println("Template File:", *t)
 		println("Verbosity:", *v)
 		println("Minimum password length:", *min_len)
 		println("Maximum password length:", *max_len)
-		println("Number of threads:", *n_threads)
+		println("Number of threads:", *threads_flag)
 		println("Presale file:", *pre_sale)
 		println("Keep order:", *keep_order)
+		println("Order:", *order)
 	}
 
 	if *re <= 0 {
@@ -108,30 +166,69 @@ func main() {
 	params.StartTime = time.Now()
 	params.RE = *re
 
-	if *pk == "" {
+	if *pk == "" && *keystore_dir == "" && *mnemonic_flag == "" && *dump == "" {
 		panic("No key file")
 	}
 
-	if *n_threads < 1 || *n_threads > 32 {
-		panic("Wrong muber of threads ")
+	// the mnemonic file is the target too, unless the keys are given
+	var mnemonic string
+	var mnemonic_targets []*keystore.Target
+	if *mnemonic_flag != "" {
+		mnemonic, mnemonic_targets, err = keystore.LoadMnemonic(*mnemonic_flag)
+		if err != nil {
+			panic(err)
+		}
 	}
 
-	if *n_threads > 1 {
-		wg.Add(*n_threads)
-		chans = make([]chan string, *n_threads)
-		for i := 0; i < *n_threads; i++ {
-			chans[i] = make(chan string)
+	if *dump == "" {
+		format := *key_format
+		if *pre_sale {
+			format = "presale"
+		}
 
-			go func(index int) {
+		if *pk != "" {
+			params.Targets, err = keystore.LoadTargets(format, strings.Split(*pk, ","))
+			if err != nil {
+				panic(err)
+			}
+		}
 
-				for {
-					s := <-chans[index]
+		if *mnemonic_flag != "" && *pk == "" && *keystore_dir == "" {
+			params.Targets = mnemonic_targets
+		}
+
+		if *keystore_dir != "" {
+			accs, err := keystore.LoadKeystore(format, *keystore_dir)
+			if err != nil {
+				panic(err)
+			}
+			params.Targets = append(params.Targets, accs...)
+		}
+
+		if *v > 0 {
+			for _, t := range params.Targets {
+				println("Key:", t.Verifier.Describe())
+			}
+		}
+	}
 
-					if s == "" {
-						wg.Done()
-						break
-					}
+	n_threads = parse_threads(*threads_flag, keystore.MemoryPerThread(params.Targets), available_memory())
 
+	if *v > 0 && *threads_flag == "auto" {
+		println("Threads:", n_threads, "of", runtime.NumCPU(), "CPUs, memory per thread:", keystore.MemoryPerThread(params.Targets)>>20, "MB")
+	}
+
+	if n_threads > 1 {
+		wg.Add(n_threads)
+		chans = make([]chan string, n_threads)
+		for i := 0; i < n_threads; i++ {
+			chans[i] = make(chan string)
+
+			go func(index int) {
+				defer wg.Done()
+
+				// the channel is closed when all the variants are sent
+				for s := range chans[index] {
 					keystore.Test_pass(&params, s, index)
 				}
 
@@ -139,38 +236,100 @@ func main() {
 		}
 	}
 
-	if *pre_sale {
-		err := keystore.LoadPresaleFile(&params, *pk)
+	templates = make([][]string, 0)
+	templates_flags = make([]TEMP_FLAGS, 0)
+
+	if *l == "" && *mask_flag != "" {
+		m, err := new_mask(*mask_flag, *mask_charset)
 		if err != nil {
 			panic(err)
 		}
-	} else {
-		err := keystore.LoadKeyFile(&params, *pk, *v)
-		if err != nil {
-			panic(err)
+		gen = m
+
+		if *v > 0 {
+			println("Mask:", *mask_flag)
+			println("Unknown positions:", m.unknowns())
+		}
+	} else if *l == "" && *mnemonic_flag != "" {
+		words := strings.Fields(mnemonic)
+
+		var wl *bip39_list
+		if *wordlist != "" {
+			wl, err = new_bip39_list(*wordlist)
+			if err != nil {
+				panic(err)
+			}
+		} else {
+			wl = detect_wordlist(words)
 		}
-	}
 
-	templates = make([][]string, 0)
-	templates_flags = make([]TEMP_FLAGS, 0)
+		if *mnemonic_order {
+			p, err := new_mnemonic_perm(words, wl)
+			if err != nil {
+				panic(err)
+			}
+			gen = p
 
-	pl := make([]string, 0)
+			if *v > 0 {
+				println("Wordlist:", wl.name)
+				println("Scrambled words:", p.free)
+			}
+		} else {
+			m, err := new_mnemonic_gen(words, wl)
+			if err != nil {
+				panic(err)
+			}
+			gen = m
 
-	if *l != "" {
-		f, err := os.Open(*l)
-		if err != nil {
-			panic(err)
+			if *v > 0 {
+				println("Wordlist:", wl.name)
+				println("Unknown words:", m.unknowns())
+			}
+		}
+		checksum = wl.checksum_ok
+	} else if *l == "" && *near != "" {
+		if *near_dist < 0 {
+			panic("Wrong -near_dist")
 		}
 
-		scanner := bufio.NewScanner(f)
-		for scanner.Scan() {
-			pl = append(pl, scanner.Text())
+		passwords := read_lines(*near)
+		gen = new_near(passwords, *near_dist)
+
+		if *v > 0 {
+			println("Remembered passwords:", len(passwords))
+			println("Maximum edit distance:", *near_dist)
+		}
+	} else if *l == "" && *prince_flag != "" {
+		if *prince_elems < 1 || *prince_min_elem < 1 || *prince_max_elem < *prince_min_elem {
+			panic("Wrong -prince_elems, -prince_min_elem or -prince_max_elem")
 		}
 
-		if err := scanner.Err(); err != nil {
-			panic(err)
+		p := new_prince(read_lines(*prince_flag), *prince_elems, *prince_min_elem, *prince_max_elem, *min_len, *max_len)
+		gen = p
+
+		if *v > 0 {
+			println("PRINCE words:", p.words())
+			println("Maximum words in a chain:", *prince_elems)
+		}
+	} else if *l != "" && *l_flags == "" {
+		gen = list(read_lines(*l))
+	} else if *l != "" {
+		// the list is a single template line with the flags
+		if !strings.HasPrefix(*l_flags, "~") {
+			panic("Wrong -l_flags: " + *l_flags)
+		}
+
+		tf := parse_flags(*l_flags)
+		if tf.Name != "" || len(tf.Conds) > 0 {
+			panic("No line names or conditions in -l_flags: " + *l_flags)
+		}
+
+		templates = append(templates, transform_tokens(read_lines(*l), tf))
+		templates_flags = append(templates_flags, tf)
+
+		if *v > 0 {
+			println("List variants:", len(templates[0]))
 		}
-		f.Close()
 	} else {
 		if *t == "" {
 			panic("No template file")
@@ -205,30 +364,19 @@ func main() {
 					templ[i] = strings.Replace(templ[i], "\\s", " ", -1)
 				}
 
-				var tf TEMP_FLAGS
+				tf := TEMP_FLAGS{Repeat: 1}
 
 				if len(templ) > 0 && strings.HasPrefix(templ[0], "~") {
 					if len(templ) == 1 {
 						continue
 					} //nothing but flags...
 
-					tf.UseAlways = strings.Index(templ[0], "a") > 0
-					tf.Capitalize = strings.Index(templ[0], "c") > 0
+					tf = parse_flags(templ[0])
 
 					templ = templ[1:] //remove the first
 				}
 
-				if tf.Capitalize {
-					t := make([]string, 0)
-
-					for _, n := range templ {
-						if len(n) > 0 {
-							t = safe_add(t, string(unicode.ToUpper([]rune(n)[0]))+n[1:])
-							t = safe_add(t, string(unicode.ToLower([]rune(n)[0]))+n[1:])
-						}
-						templ = t
-					}
-				}
+				templ = transform_tokens(templ, tf)
 
 				if len(templ) > 0 {
 					templates = append(templates, templ)
@@ -252,77 +400,91 @@ func main() {
 
 	//calculate number of variants:
 
-	counters := make([]int, len(templates)+1)
-	indexes := make([]int, len(templates))
-	for i := 0; i < len(indexes); i++ {
-		if templates_flags[i].UseAlways {
-			indexes[i] = 1
+	if gen == nil {
+		tg := new_template_gen(templates, templates_flags, *keep_order, *near_order)
+		gen = tg
+
+		if *v > 0 {
+			println("Line blocks:", tg.blocks())
 		}
 	}
 
-	if *l != "" {
-		params.Total = len(pl)
-	} else if *keep_order {
-
-		a_exists := false
-
-		params.Total = 1
-		for i := 0; i < len(templates); i++ {
-			if templates_flags[i].UseAlways {
-				params.Total = params.Total * len(templates[i])
-				a_exists = true
-			} else {
-				params.Total = params.Total * (len(templates[i]) + 1)
-			}
+	if *prefixes != "" || *suffixes != "" {
+		var pre, suf []string
+		if *prefixes != "" {
+			pre = read_lines(*prefixes)
 		}
-		if !a_exists {
-			params.Total = params.Total - 1
+		if *suffixes != "" {
+			suf = read_lines(*suffixes)
 		}
-	} else {
-		//        if len( templates ) > 20 { panic( "Too many templates. No way you have so much powerful computer...")}
-
-	counter:
-		for {
-			not_zero := 0
-			for _, k := range indexes {
-				if k != 0 {
-					not_zero++
-				}
-			}
 
-			counters[not_zero]++
-
-			for i := 0; i < len(indexes); i++ {
-
-				if indexes[i] < len(templates[i]) {
-					indexes[i] = indexes[i] + 1
-					break
-				} else {
-					if templates_flags[i].UseAlways {
-						indexes[i] = 1
-					} else {
-						indexes[i] = 0
-					}
-					if i == len(templates)-1 {
-						break counter
-					}
-				}
-			}
+		a := new_affixed(gen, pre, suf)
+		gen = a
+
+		if *v > 0 {
+			println("Prefixes:", len(a.prefixes)-1)
+			println("Suffixes:", len(a.suffixes)-1)
 		}
+	}
 
-		for i, c := range counters {
-			//println( "counters ", i, c )
-			params.Total += c * fact(i)
+	switch *order {
+	case "seq":
+	case "random":
+		gen = new_shuffled(gen, *order_key)
+	default:
+		panic("Wrong -order: " + *order)
+	}
+
+	if *shard_flag != "" {
+		all := gen.total()
+
+		gen, err = new_shard(gen, *shard_flag)
+		if err != nil {
+			panic(err)
+		}
 
-			//XAXA            if params.Total > 10000000000 { panic( "Too many templates. No way you have so much powerful computer...")}
+		if *v > 0 {
+			println("Shard:", *shard_flag, "of total", all, "variants")
+		}
+	}
 
+	if *enc != "" {
+		if err := parse_encodings(*enc); err != nil {
+			panic(err)
 		}
 	}
 
+	params.Total = safe_mul(gen.total(), variants_count())
+
 	if *v > 0 {
 		println("Total possible variants:", params.Total)
 	}
 
+	expr := *filter_flag
+	if *policy != "" {
+		p, ok := policies[*policy]
+		if !ok {
+			panic("Unknown -policy: " + *policy)
+		}
+
+		if expr != "" {
+			expr = "(" + p + ") && (" + expr + ")"
+		} else {
+			expr = p
+		}
+	}
+
+	if expr != "" {
+		filter, err = new_filter(expr)
+		if err != nil {
+			panic(err)
+		}
+
+		if *v > 0 {
+			println("Filter:", expr)
+		}
+	}
+
 	if strings.HasSuffix(*start_from, "%") {
 
 		p, err := strconv.Atoi((*start_from)[:len(*start_from)-1])
@@ -349,113 +511,216 @@ func main() {
 	}
 
 	//main cycle
-	if *l != "" {
-		for _, np := range pl {
-			if *n_threads == 1 {
-				keystore.Test_pass(&params, np, 0)
-			} else {
-				chans[params.N%*n_threads] <- np
-			}
+	for i := 0; i < gen.total(); {
+		s, n := at_max(gen, i, *max_len)
+		if n > 0 {
+			// the selected tokens are already too long, in any order
+			skip("length", s, n*variants_count())
+			i += n
+			continue
 		}
-	} else {
 
-		indexes = make([]int, len(templates))
-		for i := 0; i < len(indexes); i++ {
-			if templates_flags[i].UseAlways {
-				indexes[i] = 1
-			}
+		test(s)
+		i++
+	}
+
+	if *dump != "" {
+		if err := f_dump.close(); err != nil {
+			panic(err)
 		}
+		return
+	}
 
-	main:
-		for {
+	//wait for threads to finish
+	if n_threads > 1 {
+		for i := 0; i < n_threads; i++ {
+			close(chans[i])
+		}
+		wg.Wait()
+	}
 
-			letters := make([]string, 0)
+	if len(params.Solved) > 0 {
+		println("Passwords found for:")
+		for _, t := range params.Solved {
+			println("   ", t.String(), "Password:", t.Password)
+		}
+		println(":-( Sorry... passwords not found for:")
+		for _, t := range params.Targets {
+			println("   ", t.String())
+		}
+	} else if *v > 0 {
+		println(":-( Sorry... password not found")
+	}
 
-			for i := 0; i < len(indexes); i++ {
-				if indexes[i] > 0 {
-					letters = append(letters, templates[i][indexes[i]-1])
-				}
-			}
+	if *v > 0 {
+		if skipped_by["length"] > 0 {
+			println("NOTE:", skipped_by["length"], "variants skipped because of length limitations")
+		}
+		if skipped_by["checksum"] > 0 {
+			println("NOTE:", skipped_by["checksum"], "mnemonics skipped by the checksum")
+		}
+		if skipped_by["filter"] > 0 {
+			println("NOTE:", skipped_by["filter"], "variants skipped by the filter")
+		}
+		if skipped_by["encoding"] > 0 {
+			println("NOTE:", skipped_by["encoding"], "variants skipped as not encodable")
+		}
+		if skipped_by["duplicate"] > 0 {
+			println("NOTE:", skipped_by["duplicate"], "variants skipped as duplicates")
+		}
+	}
+}
 
-			letters_str := ""
-			for _, l := range letters {
-				letters_str += "(" + l + ") "
-			}
+// parse_flags parses the first word of a template line ( or -l_flags )
+func parse_flags(word string) TEMP_FLAGS {
+	var tf TEMP_FLAGS
+	var fl string
 
-			if *v > 1 && params.N >= params.Start_from {
-				println("Selected letters:", letters_str)
-			}
+	fl, tf.Name, tf.Conds = parse_deps(word)
 
-			if *keep_order {
-				test(letters)
-			} else {
+	tf.UseAlways = strings.Index(fl, "a") > 0
+	tf.Capitalize = strings.Index(fl, "c") > 0
+	tf.Keep = strings.Index(fl, "k") > 0
+	tf.Permute = strings.Index(fl, "p") > 0
+	tf.Repeat, tf.Same = parse_repeat(fl)
 
-				s := ""
-				for _, n := range letters {
-					s = s + n
-				}
-				if len(s) > *max_len {
-					N := fact(len(letters))
-					params.Skipped = params.Skipped + N
+	return tf
+}
 
-					if params.V > 1 {
-						fmt.Printf("Skipped %d too long variants\n", N)
-					}
+// transform_tokens makes all the variants of the tokens the line flags ask for
+func transform_tokens(tokens []string, tf TEMP_FLAGS) []string {
+	if !tf.Capitalize {
+		return tokens
+	}
 
-				} else {
-					AllPermutations(letters, 0)
-				}
-			}
+	res := make([]string, 0, 2*len(tokens))
+	seen := make(map[string]bool)
 
-			for i := 0; i < len(indexes); i++ {
-
-				if indexes[i] < len(templates[i]) {
-					indexes[i] = indexes[i] + 1
-					break
-				} else {
-					if templates_flags[i].UseAlways {
-						indexes[i] = 1
-					} else {
-						indexes[i] = 0
-					}
-					if i == len(templates)-1 {
-						break main
-					}
-				}
-			}
+	add := func(s string) {
+		if !seen[s] {
+			seen[s] = true
+			res = append(res, s)
+		}
+	}
 
+	for _, n := range tokens {
+		if len(n) > 0 {
+			r := []rune(n)
+			add(string(unicode.ToUpper(r[0])) + string(r[1:]))
+			add(string(unicode.ToLower(r[0])) + string(r[1:]))
 		}
 	}
 
-	//wait for threads to finish
-	if *n_threads > 1 {
-		for i := 0; i < *n_threads; i++ {
-			chans[i] <- ""
+	return res
+}
+
+// parse_repeat parses the ~rN ( N different tokens ) or ~RN ( N tokens,
+// the same token can repeat ) line flag.
+func parse_repeat(flags string) (int, bool) {
+	for i := 1; i < len(flags); i++ {
+		if flags[i] != 'r' && flags[i] != 'R' {
+			continue
 		}
-		wg.Wait()
+
+		j := i + 1
+		for j < len(flags) && unicode.IsDigit(rune(flags[j])) {
+			j++
+		}
+
+		n, err := strconv.Atoi(flags[i+1 : j])
+		if err != nil || n < 1 {
+			panic("Wrong line flag: " + flags)
+		}
+
+		return n, flags[i] == 'R'
 	}
 
-	if *v > 0 {
-		println(":-( Sorry... password not found")
-		if params.Skipped > 0 {
-			println("NOTE:", params.Skipped, "variants skipped because of length limitations")
+	return 1, false
+}
+
+// parse_deps splits the line flags into the letters, the line name ( #name )
+// and the conditions ( ?name, ?!name, ?name=token ).
+func parse_deps(flags string) (string, string, []TEMP_COND) {
+	i := strings.IndexAny(flags, "#?")
+	if i < 0 {
+		return flags, "", nil
+	}
+
+	letters := flags[:i]
+	name := ""
+	conds := make([]TEMP_COND, 0)
+
+	for i < len(flags) {
+		j := strings.IndexAny(flags[i+1:], "#?")
+		if j < 0 {
+			j = len(flags)
+		} else {
+			j += i + 1
+		}
+
+		part := flags[i+1 : j]
+
+		if flags[i] == '#' {
+			name = part
+		} else {
+			var c TEMP_COND
+
+			if strings.HasPrefix(part, "!") {
+				c.Not = true
+				part = part[1:]
+			}
+
+			if k := strings.Index(part, "="); k >= 0 {
+				if c.Not {
+					panic("Wrong line condition: " + flags)
+				}
+				part, c.Token = part[:k], part[k+1:]
+				if c.Token == "" {
+					panic("Wrong line condition: " + flags)
+				}
+			}
+
+			c.Line = part
+			conds = append(conds, c)
 		}
+
+		if part == "" {
+			panic("Wrong line flags: " + flags)
+		}
+
+		i = j
 	}
+
+	return letters, name, conds
 }
 
-func test(l []string) {
-	s := ""
-	for _, n := range l {
-		s = s + n
+func read_lines(path string) []string {
+	f, err := os.Open(path)
+	if err != nil {
+		panic(err)
 	}
+	defer f.Close()
 
-	if s == "" {
-		return
+	lines := make([]string, 0)
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+
+	if err := scanner.Err(); err != nil {
+		panic(err)
 	}
 
-	if len(s) < *min_len || len(s) > *max_len {
-		params.Skipped = params.Skipped + 1
+	return lines
+}
+
+// skip counts n variants as skipped for the reason
+func skip(reason string, s string, n int) {
+	params.Skipped = params.Skipped + n
+	skipped_by[reason] += n
 
+	if params.V > 0 {
 		h := time.Since(params.StartTime).Hours() *
 			float64(params.Total-(params.N+params.Skipped)) / float64(params.N+params.Skipped-params.Start_from)
 
@@ -479,43 +744,67 @@ func test(l []string) {
 					int64(h)/(24*365), (int64(h)%(24*365))/24, int64(h)%24, int64(h*60)%60)
 			}
 		}
+	}
+}
+
+func test(s string) {
+	vs := variants(s)
 
+	if s == "" || len(s) < *min_len || len(s) > *max_len {
+		skip("length", s, len(vs))
 		return
 	}
 
-	if *dump != "" {
-		f_dump.Write([]byte(s + "\n"))
+	if checksum != nil && !checksum(s) {
+		skip("checksum", s, len(vs))
 		return
 	}
 
-	if *n_threads == 1 {
-		keystore.Test_pass(&params, s, 0)
-	} else {
-		chans[params.N%*n_threads] <- s
+	if filter != nil && filter(new_pass_info(s)) == 0 {
+		skip("filter", s, len(vs))
+		return
 	}
-}
 
-func makecopy(l []string) []string {
-	nl := make([]string, len(l))
-	copy(nl, l)
-	return nl
+next:
+	for i, p := range vs {
+		if p.bad {
+			skip("encoding", s, 1)
+			continue
+		}
+
+		if p.s == "" {
+			skip("length", s, 1)
+			continue
+		}
+
+		for _, d := range vs[:i] {
+			if d == p {
+				skip("duplicate", s, 1)
+				continue next
+			}
+		}
+
+		try(p.s)
+	}
 }
 
-func AllPermutations(l []string, index int) {
+// try sends the password to the cracking threads, or to the dump
+func try(s string) {
+	if *dump != "" {
+		params.N++
+		if params.N+params.Skipped < params.Start_from {
+			return
+		}
 
-	if index >= len(l)-1 {
-		test(l)
+		if err := f_dump.write(s); err != nil {
+			panic(err)
+		}
 		return
 	}
 
-	r := len(l) - index
-
-	AllPermutations(l, index+1)
-	for j := 1; j < r; j++ {
-		//swap i and i + j
-		tmp := l[index]
-		l[index] = l[index+j]
-		l[index+j] = tmp
-		AllPermutations(makecopy(l), index+1)
+	if n_threads == 1 {
+		keystore.Test_pass(&params, s, 0)
+	} else {
+		chans[params.N%n_threads] <- s
 	}
 }
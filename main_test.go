@@ -0,0 +1,949 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// all_of returns every variant of the generator
+func all_of(g generator) []string {
+	res := make([]string, g.total())
+	for i := range res {
+		res[i] = g.at(i)
+	}
+	return res
+}
+
+func TestNear(t *testing.T) {
+	// a small alphabet to get far enough to drop the levels
+	defer func(p []rune) { printable = p }(printable)
+	printable = []rune("abc")
+
+	passwords := []string{"ab", "abc", "ab"}
+	const k = 5
+
+	// the reference keeps all the levels and one seen set
+	seen := map[string]bool{"ab": true, "abc": true}
+	want := []string{"ab", "abc"}
+	level := want
+	for d := 1; d <= k; d++ {
+		next := make([]string, 0)
+		for _, s := range level {
+			for _, e := range edits(s) {
+				if !seen[e] {
+					seen[e] = true
+					next = append(next, e)
+				}
+			}
+		}
+		want = append(want, next...)
+		level = next
+	}
+
+	g := new_near(passwords, k)
+	if g.total() != len(want) {
+		t.Fatalf("total %d, want %d", g.total(), len(want))
+	}
+	if len(g.levels) > 3 {
+		t.Errorf("%d levels kept", len(g.levels))
+	}
+
+	got := all_of(g)
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("variant %d: %q, want %q", i, got[i], want[i])
+		}
+	}
+
+	// back to the dropped distance 1 and forth again
+	for _, i := range []int{len(want) - 1, 2, len(want) - 1, 0, g.sizes[0] + g.sizes[1] + 5} {
+		if s := g.at(i); s != want[i] {
+			t.Errorf("variant %d: %q, want %q", i, s, want[i])
+		}
+	}
+}
+
+// parse_template reads the template lines like main does
+func parse_template(text string) ([][]string, []TEMP_FLAGS) {
+	lines := make([][]string, 0)
+	flags := make([]TEMP_FLAGS, 0)
+
+	for _, l := range strings.Split(strings.TrimSpace(text), "\n") {
+		tokens := strings.Fields(l)
+		tf := TEMP_FLAGS{Repeat: 1}
+		if strings.HasPrefix(tokens[0], "~") {
+			tf = parse_flags(tokens[0])
+			tokens = tokens[1:]
+		}
+		lines = append(lines, tokens)
+		flags = append(flags, tf)
+	}
+
+	return lines, flags
+}
+
+// ref_pieces returns every way to use the line: the sequences of 1..Repeat tokens
+func ref_pieces(tokens []string, f TEMP_FLAGS) []string {
+	res := make([]string, 0)
+
+	var walk func(s string, used map[int]bool, left int)
+	walk = func(s string, used map[int]bool, left int) {
+		if s != "" {
+			res = append(res, s)
+		}
+		if left == 0 {
+			return
+		}
+		for i, t := range tokens {
+			if used[i] && !f.Same {
+				continue
+			}
+			used[i] = true
+			walk(s+t, used, left-1)
+			used[i] = false
+		}
+	}
+	walk("", make(map[int]bool), f.Repeat)
+
+	return res
+}
+
+// ref_perms returns the orders of the items at most k adjacent swaps away ( k < 0: any )
+func ref_perms(items []string, k int) []string {
+	res := make([]string, 0)
+
+	var walk func(s string, rest []string, inv int)
+	walk = func(s string, rest []string, inv int) {
+		if len(rest) == 0 {
+			res = append(res, s)
+			return
+		}
+		for d := range rest {
+			if k >= 0 && inv+d > k {
+				break
+			}
+			r := append(append([]string{}, rest[:d]...), rest[d+1:]...)
+			walk(s+rest[d], r, inv+d)
+		}
+	}
+	walk("", items, 0)
+
+	return res
+}
+
+// ref_template is the plain brute force of the template: every choice of the
+// lines, the conditions checked at the end, every order of every block.
+func ref_template(lines [][]string, flags []TEMP_FLAGS, keep_order bool, near_order int) []string {
+	names := make(map[string]int)
+	for i, f := range flags {
+		if f.Name != "" {
+			names[f.Name] = i
+		}
+	}
+
+	holds := func(c TEMP_COND, chosen []string) bool {
+		p := chosen[names[c.Line]]
+		switch {
+		case c.Not:
+			return p == ""
+		case c.Token != "":
+			return strings.EqualFold(p, c.Token)
+		}
+		return p != ""
+	}
+
+	valid := func(chosen []string) bool {
+		for j, f := range flags {
+			all := true
+			for _, c := range f.Conds {
+				all = all && holds(c, chosen)
+			}
+			if chosen[j] != "" && !all {
+				return false
+			}
+			if f.UseAlways && all && chosen[j] == "" {
+				return false
+			}
+		}
+		return true
+	}
+
+	fixed := func(i int) bool {
+		return flags[i].Keep || (keep_order && !flags[i].Permute)
+	}
+
+	res := make([]string, 0)
+
+	var orders func(prefix string, chosen []string, from int)
+	orders = func(prefix string, chosen []string, from int) {
+		if from == len(lines) {
+			res = append(res, prefix)
+			return
+		}
+
+		to := from + 1
+		for !fixed(from) && to < len(lines) && !fixed(to) {
+			to++
+		}
+
+		block := make([]string, 0)
+		for _, p := range chosen[from:to] {
+			if p != "" {
+				block = append(block, p)
+			}
+		}
+		for _, o := range ref_perms(block, near_order) {
+			orders(prefix+o, chosen, to)
+		}
+	}
+
+	var choose func(chosen []string)
+	choose = func(chosen []string) {
+		j := len(chosen)
+		if j == len(lines) {
+			if valid(chosen) && strings.Join(chosen, "") != "" {
+				orders("", chosen, 0)
+			}
+			return
+		}
+
+		choose(append(chosen, ""))
+		for _, p := range ref_pieces(lines[j], flags[j]) {
+			choose(append(chosen[:j:j], p))
+		}
+	}
+	choose(make([]string, 0, len(lines)))
+
+	return res
+}
+
+func TestTemplate(t *testing.T) {
+	tests := []struct {
+		name       string
+		text       string
+		keep_order bool
+		near_order int
+	}{
+		{"plain", "a b\nc d e\nf\ng h", false, -1},
+		{"keep_order", "a b\nc d e\nf\ng h", true, -1},
+		{"keep and permute", "~k a b\nc d\ne\n~k f\ng h\ni", false, -1},
+		{"permute with keep_order", "a b\n~p c d\n~p e\nf\n~p g h\n~p i", true, -1},
+		{"repeat", "~r2 a b c\nd e\n~R2 f g", false, -1},
+		{"repeat always", "~ar3 a b c\n~aR2 d e\nf", false, -1},
+		{"near_order 1", "a b\nc\nd e\nf\ng", false, 1},
+		{"near_order 2", "a b\nc\nd e\nf\ng", false, 2},
+		{"near_order and keep", "a b\nc\n~k d e\nf\ng", false, 1},
+		{"always", "~a a b\nc d\n~a e", false, -1},
+		{"conditions", "~#x a b\n~?x c d\n~?!x e\n~#y f g\n~?y=G?x h", false, -1},
+		{"condition always", "~#x a b\n~a?x c\n~a?!x d e\nf", false, -1},
+		{"condition tokens", "~#x a b c\n~?x=a d\n~?x=b e\n~?x=a?!z f\n~#z g", false, -1},
+		{"condition forward", "~?z=h a\n~?!z b\nc\n~#z h i", true, -1},
+		{"conditions near_order", "~#x a b\n~?x c d\ne\n~a?x f", false, 1},
+	}
+
+	for _, test := range tests {
+		lines, flags := parse_template(test.text)
+		want := ref_template(lines, flags, test.keep_order, test.near_order)
+
+		lines, flags = parse_template(test.text)
+		g := new_template_gen(lines, flags, test.keep_order, test.near_order)
+		got := all_of(g)
+
+		// the letters are different, so the variants are different too
+		distinct := make(map[string]bool)
+		for _, s := range got {
+			distinct[s] = true
+		}
+		if len(distinct) != g.total() {
+			t.Errorf("%s: %d distinct variants of %d", test.name, len(distinct), g.total())
+		}
+
+		sort.Strings(want)
+		sort.Strings(got)
+		if strings.Join(got, " ") != strings.Join(want, " ") {
+			t.Errorf("%s: %d variants, want %d\n got: %v\nwant: %v", test.name, len(got), len(want), got, want)
+		}
+	}
+}
+
+func TestTemplateAtMax(t *testing.T) {
+	lines, flags := parse_template("a bb\nccc d\n~r2 ee f\ng")
+	g := new_template_gen(lines, flags, false, -1)
+
+	for _, max := range []int{0, 1, 3, 5, 100} {
+		for i := 0; i < g.total(); {
+			s, n := g.at_max(i, max)
+			if n == 0 {
+				if s != g.at(i) || len(s) > max {
+					t.Fatalf("max %d, variant %d: %q, want %q", max, i, s, g.at(i))
+				}
+				i++
+				continue
+			}
+
+			// all the run is too long
+			if i+n > g.total() {
+				t.Fatalf("max %d, variant %d: run of %d over the total", max, i, n)
+			}
+			for ; n > 0; n-- {
+				if len(g.at(i)) <= max {
+					t.Fatalf("max %d, variant %d: %q skipped", max, i, g.at(i))
+				}
+				i++
+			}
+		}
+	}
+}
+
+func TestShuffle(t *testing.T) {
+	for _, n := range []int{1, 2, 3, 17, 1000} {
+		s := new_shuffle(n, "key")
+
+		seen := make([]bool, n)
+		for i := 0; i < n; i++ {
+			x := s.at(i)
+			if x < 0 || x >= n || seen[x] {
+				t.Fatalf("n %d: %d goes to %d twice or out of range", n, i, x)
+			}
+			seen[x] = true
+		}
+	}
+
+	// another key, another order
+	a, b := new_shuffle(1000, "key"), new_shuffle(1000, "other")
+	same := 0
+	for i := 0; i < 1000; i++ {
+		if a.at(i) == b.at(i) {
+			same++
+		}
+	}
+	if same > 20 {
+		t.Errorf("%d of 1000 places are the same with another key", same)
+	}
+}
+
+func TestShard(t *testing.T) {
+	for _, total := range []int{0, 1, 2, 5, 17, 100} {
+		for _, n := range []int{1, 2, 3, 7, 10} {
+			g := make(list, total)
+			for i := range g {
+				g[i] = fmt.Sprint(i)
+			}
+
+			// the shards in turn give every variant once, in the order
+			got := make([]string, 0)
+			for i := 1; i <= n; i++ {
+				s, err := new_shard(g, fmt.Sprintf("%d/%d", i, n))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if s.total() < total/n || s.total() > total/n+1 {
+					t.Errorf("total %d, shard %d/%d: %d variants", total, i, n, s.total())
+				}
+				got = append(got, all_of(s)...)
+			}
+
+			if strings.Join(got, " ") != strings.Join(g, " ") {
+				t.Errorf("total %d, %d shards: %v", total, n, got)
+			}
+		}
+	}
+
+	for _, spec := range []string{"0/3", "4/3", "1/0", "1", "a/b", "1/2/3"} {
+		if _, err := new_shard(list{"a"}, spec); err == nil {
+			t.Errorf("wrong shard %s accepted", spec)
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	tests := []struct {
+		expr string
+		pass string
+		want int
+	}{
+		{"len", "Pass word1!", 11},
+		{"len >= 9", "password", 0},
+		{"len >= 9", "password1", 1},
+		{"hasUpper && hasDigit", "Password1", 1},
+		{"hasUpper && hasDigit", "password1", 0},
+		{"hasSpace || symbols > 1", "pass word", 1},
+		{"hasSpace || symbols > 1", "pass!word?", 1},
+		{"hasSpace || symbols > 1", "pass!word", 0},
+		{"!hasSpace", "pass word", 0},
+		{"!!hasSpace", "pass word", 1},
+		{"digits == 2 && lower != 0", "ab12", 1},
+		{"digits < 2 || len <= 3", "ab12", 0},
+		{"hasNonASCII && nonASCII == 2", "пaр", 1},
+		{"len == 3", "пaр", 1}, // the characters, not the bytes
+		// && binds stronger than ||, the parentheses change it
+		{"hasDigit || hasUpper && hasSpace", "1", 1},
+		{"(hasDigit || hasUpper) && hasSpace", "1", 0},
+	}
+
+	for _, test := range tests {
+		f, err := new_filter(test.expr)
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+			continue
+		}
+		if got := f(new_pass_info(test.pass)); got != test.want {
+			t.Errorf("%s on %q: %d, want %d", test.expr, test.pass, got, test.want)
+		}
+	}
+
+	for _, expr := range []string{"", "len >=", "upper + 0", "(len > 1", "len > 1)", "foo", "len > 1 &&", "len = 1", "99999999999999999999"} {
+		if _, err := new_filter(expr); err == nil {
+			t.Errorf("wrong filter %q accepted", expr)
+		}
+	}
+
+	for name, expr := range policies {
+		if _, err := new_filter(expr); err != nil {
+			t.Errorf("policy %s: %v", name, err)
+		}
+	}
+}
+
+func TestMask(t *testing.T) {
+	tests := []struct {
+		mask, charset string
+		want          []string // the positions
+	}{
+		{"ab", "", []string{"a", "b"}},
+		{"a[xyz]", "", []string{"a", "xyz"}},
+		{"[a-c0-2]", "", []string{"abc012"}},
+		{"[aa-c]", "", []string{"abc"}}, // no duplicates
+		{"[a-]", "", []string{"a-"}},
+		{"[\\]\\\\]", "", []string{"]\\"}},
+		{"\\?\\[\\\\", "", []string{"?", "[", "\\"}},
+		{"x?", "01", []string{"x", "01"}},
+		{"пр[иы]", "", []string{"п", "р", "иы"}},
+	}
+
+	for _, test := range tests {
+		m, err := new_mask(test.mask, test.charset)
+		if err != nil {
+			t.Errorf("%s: %v", test.mask, err)
+			continue
+		}
+
+		got := make([]string, len(m.positions))
+		for i, p := range m.positions {
+			got[i] = string(p)
+		}
+		if strings.Join(got, " ") != strings.Join(test.want, " ") {
+			t.Errorf("%s: positions %q, want %q", test.mask, got, test.want)
+		}
+	}
+
+	m, err := new_mask("a?[xy]", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.total() != 95*2 || m.unknowns() != 2 {
+		t.Errorf("total %d, unknowns %d", m.total(), m.unknowns())
+	}
+	if m.at(0) != "a x" || m.at(1) != "a y" || m.at(m.total()-1) != "a~y" {
+		t.Errorf("variants %q, %q, %q", m.at(0), m.at(1), m.at(m.total()-1))
+	}
+
+	for _, mask := range []string{"", "[]", "[abc", "[c-a]", "a[b"} {
+		if _, err := new_mask(mask, ""); err == nil {
+			t.Errorf("wrong mask %q accepted", mask)
+		}
+	}
+}
+
+func TestDumpShardName(t *testing.T) {
+	tests := []struct {
+		path  string
+		shard int
+		want  string
+	}{
+		{"v.txt", 0, "v-0.txt"},
+		{"v.txt.gz", 1, "v-1.txt.gz"},
+		{"v", 2, "v-2"},
+		{"/tmp/a.b/v.zst", 3, "/tmp/a.b/v-3.zst"},
+		{"dir/.hidden", 4, "dir/.hidden-4"},
+	}
+
+	for _, test := range tests {
+		if got := dump_shard_name(test.path, test.shard); got != test.want {
+			t.Errorf("%s, %d: %s, want %s", test.path, test.shard, got, test.want)
+		}
+	}
+}
+
+func TestTemplateLongFixed(t *testing.T) {
+	// 25 lines in their places, 3^25 - 1 variants and no 25! anywhere
+	const want = 847288609443 - 1
+
+	lines, flags := parse_template(strings.Repeat("a b\n", 25))
+	if g := new_template_gen(lines, flags, true, -1); g.total() != want {
+		t.Errorf("-keep_order: total %d, want %d", g.total(), want)
+	}
+
+	lines, flags = parse_template(strings.Repeat("~k a b\n", 25))
+	g := new_template_gen(lines, flags, false, -1)
+	if g.total() != want {
+		t.Errorf("~k: total %d, want %d", g.total(), want)
+	}
+	if s := g.at(g.total() - 1); s != strings.Repeat("b", 25) {
+		t.Errorf("last variant %q", s)
+	}
+}
+
+// ref_prince chains every 1..elems words and sorts the chains by the total
+// length, then by the number of words, then by the length and the place of
+// every word in turn
+func ref_prince(words []string, elems, min_elem, max_elem, min_len, max_len int) []string {
+	uniq := make([]string, 0)
+	index := make(map[string]int)
+	for _, w := range words {
+		if _, ok := index[w]; !ok && len(w) > 0 && len(w) >= min_elem && len(w) <= max_elem {
+			index[w] = len(uniq)
+			uniq = append(uniq, w)
+		}
+	}
+
+	chains := make([][]string, 0)
+	var add func(chain []string)
+	add = func(chain []string) {
+		if len(chain) > 0 {
+			chains = append(chains, chain)
+		}
+		if len(chain) == elems {
+			return
+		}
+		for _, w := range uniq {
+			add(append(append([]string{}, chain...), w))
+		}
+	}
+	add(nil)
+
+	key := func(chain []string) []int {
+		k := []int{len(strings.Join(chain, "")), len(chain)}
+		for _, w := range chain {
+			k = append(k, len(w), index[w])
+		}
+		return k
+	}
+	sort.Slice(chains, func(a, b int) bool {
+		ka, kb := key(chains[a]), key(chains[b])
+		for i := range ka {
+			if ka[i] != kb[i] {
+				return ka[i] < kb[i]
+			}
+		}
+		return false
+	})
+
+	res := make([]string, 0)
+	for _, chain := range chains {
+		if n := len(strings.Join(chain, "")); n >= min_len && n <= max_len {
+			res = append(res, strings.Join(chain, ""))
+		}
+	}
+	return res
+}
+
+func TestPrince(t *testing.T) {
+	words := []string{"ab", "c", "", "def", "c", "gh", "ijkl", "ab", "m"}
+
+	tests := []struct {
+		elems, min_elem, max_elem, min_len, max_len int
+	}{
+		{1, 1, 100, 0, 100},
+		{2, 1, 100, 0, 100},
+		{3, 1, 100, 0, 100},
+		{3, 1, 100, 4, 6},
+		{3, 2, 3, 0, 100},
+		{4, 1, 1, 2, 3},
+		{2, 1, 100, 5, 5},
+		{3, 1, 100, 0, 2},
+		{2, 1, 100, 6, 3},
+		{2, 5, 100, 0, 100},
+	}
+
+	for _, test := range tests {
+		want := ref_prince(words, test.elems, test.min_elem, test.max_elem, test.min_len, test.max_len)
+		got := all_of(new_prince(words, test.elems, test.min_elem, test.max_elem, test.min_len, test.max_len))
+		if strings.Join(got, " ") != strings.Join(want, " ") {
+			t.Errorf("%+v:\n got %v\nwant %v", test, got, want)
+		}
+	}
+}
+
+func TestMnemonicChecksum(t *testing.T) {
+	l, _ := new_bip39_list("english")
+
+	tests := []struct {
+		mnemonic string
+		ok       bool
+	}{
+		{strings.Repeat("abandon ", 11) + "about", true},
+		{strings.Repeat("abandon ", 23) + "art", true},
+		{strings.Repeat("zoo ", 11) + "wrong", true},
+		{strings.Repeat("zoo ", 23) + "vote", true},
+		{"legal winner thank year wave sausage worth useful legal winner thank yellow", true},
+		{strings.Repeat("abandon ", 12), false},
+		{strings.Repeat("abandon ", 11) + "able", false},
+		{strings.Repeat("abandon ", 23) + "about", false},
+		{strings.Repeat("abandon ", 10) + "about", false},
+		{strings.Repeat("abandon ", 12) + "about", false},
+		{strings.Repeat("abandon ", 11) + "abot", false},
+	}
+
+	for _, test := range tests {
+		if got := l.checksum_ok(test.mnemonic); got != test.ok {
+			t.Errorf("%s: %v, want %v", test.mnemonic, got, test.ok)
+		}
+	}
+}
+
+func TestMnemonicWords(t *testing.T) {
+	l, _ := new_bip39_list("english")
+
+	if w := l.close_words("abandn"); len(w) != 1 || w[0] != "abandon" {
+		t.Errorf("abandn: %v", w)
+	}
+	if w := l.close_words("abot"); len(w) == 0 || w[0] != "about" {
+		t.Errorf("abot: %v", w)
+	}
+	if w := l.close_words("xxxxxxxx"); len(w) != 0 {
+		t.Errorf("xxxxxxxx: %v", w)
+	}
+
+	tests := []struct {
+		words []string
+		want  string
+	}{
+		{[]string{"abandon", "about"}, "english"},
+		{[]string{"abaco", "abbaglio", "abandon"}, "italian"},
+		{[]string{"的"}, "chinese_simplified"},
+		{[]string{}, "english"},
+	}
+	for _, test := range tests {
+		if got := detect_wordlist(test.words).name; got != test.want {
+			t.Errorf("%v: %s, want %s", test.words, got, test.want)
+		}
+	}
+}
+
+func TestMnemonicGen(t *testing.T) {
+	l, _ := new_bip39_list("english")
+
+	g, err := new_mnemonic_gen([]string{"=abandon", "?", "abot", "zoo?"}, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	abot, zoo := l.close_words("abot"), len(l.close_words("zoo"))
+	if g.total() != 2048*len(abot)*zoo || g.unknowns() != 3 {
+		t.Fatalf("total %d, unknowns %d", g.total(), g.unknowns())
+	}
+
+	// the word as written goes first, the last position changes first
+	if s := g.at(0); s != "abandon abandon about zoo" {
+		t.Errorf("first: %s", s)
+	}
+	if s := g.at(zoo); s != "abandon abandon "+abot[1]+" zoo" {
+		t.Errorf("at %d: %s", zoo, s)
+	}
+	if s := g.at(g.total() - 1); !strings.HasPrefix(s, "abandon zoo ") {
+		t.Errorf("last: %s", s)
+	}
+
+	seen := make(map[string]bool)
+	for i := 0; i < len(abot)*zoo*3; i++ {
+		s := g.at(i)
+		if seen[s] {
+			t.Errorf("%s twice", s)
+		}
+		seen[s] = true
+	}
+
+	if _, err := new_mnemonic_gen([]string{"abandon", "xxxxxxxx"}, l); err == nil {
+		t.Error("a word far from every word accepted")
+	}
+}
+
+func TestMnemonicPerm(t *testing.T) {
+	l, _ := new_bip39_list("english")
+
+	tests := []struct {
+		words string
+		count int
+	}{
+		{"abandon", 1},
+		{"abandon about", 2},
+		{"abandon abandon about", 3},
+		{"abandon abandon about =zoo ability", 12},
+		{"=zoo abandon about able =zoo", 6},
+		{"abandon about able above act art", 720},
+		{"abandon abandon abandon about about art", 60},
+	}
+
+	for _, test := range tests {
+		words := strings.Fields(test.words)
+		g, err := new_mnemonic_perm(words, l)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if g.total() != test.count {
+			t.Errorf("%s: total %d, want %d", test.words, g.total(), test.count)
+			continue
+		}
+
+		want := make([]string, len(words))
+		for i, w := range words {
+			want[i] = strings.TrimPrefix(w, "=")
+		}
+		sort.Strings(want)
+
+		seen := make(map[string]bool)
+		for _, s := range all_of(g) {
+			if seen[s] {
+				t.Errorf("%s: %s twice", test.words, s)
+			}
+			seen[s] = true
+
+			got := strings.Fields(s)
+			for i, w := range words {
+				if strings.HasPrefix(w, "=") && got[i] != w[1:] {
+					t.Errorf("%s: %s moved %s", test.words, s, w)
+				}
+			}
+
+			sort.Strings(got)
+			if strings.Join(got, " ") != strings.Join(want, " ") {
+				t.Errorf("%s: %s is not an order of the words", test.words, s)
+			}
+		}
+	}
+
+	if _, err := new_mnemonic_perm([]string{"abandon", "abot"}, l); err == nil {
+		t.Error("a misspelled word accepted")
+	}
+}
+
+func TestMulDiv(t *testing.T) {
+	tests := []struct{ a, b, c, want int }{
+		{6, 4, 2, 12},
+		{1, 1, 1, 1},
+		{0, 5, 3, 0},
+		{1 << 62, 3, 6, 1 << 61},
+		{math.MaxInt64, 4, 4, math.MaxInt64},
+		{1 << 40, 1 << 40, 1 << 30, 1 << 50},
+	}
+	for _, test := range tests {
+		if got := mul_div(test.a, test.b, test.c); got != test.want {
+			t.Errorf("%d*%d/%d: %d, want %d", test.a, test.b, test.c, got, test.want)
+		}
+	}
+
+	for _, test := range [][3]int{{1 << 62, 6, 3}, {1 << 62, 1 << 62, 2}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%d*%d/%d: no panic", test[0], test[1], test[2])
+				}
+			}()
+			mul_div(test[0], test[1], test[2])
+		}()
+	}
+}
+
+// long_runs is a list skipping the whole runs of the too long variants
+type long_runs list
+
+func (l long_runs) total() int {
+	return len(l)
+}
+
+func (l long_runs) at(i int) string {
+	return l[i]
+}
+
+func (l long_runs) at_max(i, max int) (string, int) {
+	n := 0
+	for i+n < len(l) && len(l[i+n]) > max {
+		n++
+	}
+	return l[i], n
+}
+
+func TestAffixed(t *testing.T) {
+	words := long_runs{"a", "bcd", "efgh", "ij", "", "klmno", "pqrstu", "v"}
+	a := new_affixed(words, []string{"1", "", "1", "xy"}, []string{"!", "12", "!"})
+
+	if a.total() != len(words)*3*3 {
+		t.Fatalf("total %d", a.total())
+	}
+
+	// the variant itself first, then the suffixes, then the prefixes
+	want := make([]string, 0)
+	for _, w := range words {
+		for _, p := range []string{"", "1", "xy"} {
+			for _, s := range []string{"", "!", "12"} {
+				want = append(want, p+w+s)
+			}
+		}
+	}
+	if got := all_of(a); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("got %v\nwant %v", got, want)
+	}
+
+	for _, max := range []int{0, 1, 2, 3, 4, 5, 6} {
+		for i := 0; i < a.total(); i++ {
+			s, n := a.at_max(i, max)
+
+			// the rest of the run of the too long variant without the affixes
+			run := 0
+			for i+run < a.total() && len(words[(i+run)/9]) > max {
+				run++
+			}
+
+			if n != run {
+				t.Errorf("max %d, at %d: skip %d, want %d", max, i, n, run)
+			}
+			if n == 0 && s != a.at(i) {
+				t.Errorf("max %d, at %d: %q, want %q", max, i, s, a.at(i))
+			}
+		}
+	}
+}
+
+// forms returns the forms of the variants to try, without the duplicates and
+// the ones not encoded
+func forms(vs []form) []string {
+	res := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, f := range vs {
+		if !f.bad && !seen[f.s] {
+			seen[f.s] = true
+			res = append(res, f.s)
+		}
+	}
+	return res
+}
+
+func TestWhitespace(t *testing.T) {
+	if n := len(variants("abc")); n != 1 || variants_count() != 1 {
+		t.Errorf("without -ws: %d variants, count %d", n, variants_count())
+	}
+
+	*ws = true
+	defer func() { *ws = false }()
+
+	tests := []struct {
+		s    string
+		want []string
+	}{
+		{"abc", []string{"abc", "abc\n", "abc\r\n", "abc ", "abc \n", " abc", " abc "}},
+		{" abc ", []string{" abc ", "abc", " abc \n", " abc \r\n", " abc  ", " abc  \n", "  abc ", "  abc  "}},
+		{"a b\n", []string{"a b\n", "a b", "a b\n\n", "a b\n\r\n", "a b\n ", "a b\n \n", " a b\n", " a b\n "}},
+	}
+
+	for _, test := range tests {
+		vs := variants(test.s)
+		if len(vs) != variants_count() || variants_count() != 8 {
+			t.Errorf("%q: %d variants, count %d", test.s, len(vs), variants_count())
+		}
+		if got := forms(vs); fmt.Sprintf("%q", got) != fmt.Sprintf("%q", test.want) {
+			t.Errorf("%q: %q, want %q", test.s, got, test.want)
+		}
+	}
+}
+
+func TestEncodings(t *testing.T) {
+	defer func() { encodings = nil }()
+
+	if err := parse_encodings("nfc,NFD, latin1,cp1251,utf16le"); err != nil {
+		t.Fatal(err)
+	}
+	if variants_count() != 6 {
+		t.Errorf("count %d", variants_count())
+	}
+
+	tests := []struct {
+		s    string
+		want []string
+	}{
+		{"ab", []string{"ab", "a\x00b\x00"}},
+		{"\u00e9", []string{"\u00e9", "e\u0301", "\xe9", "\xe9\x00"}},
+		{"e\u0301", []string{"e\u0301", "\u00e9", "e\x00\x01\x03"}},
+		{"Ж", []string{"Ж", "\xc6", "\x16\x04"}},
+	}
+
+	for _, test := range tests {
+		vs := variants(test.s)
+		if len(vs) != variants_count() {
+			t.Errorf("%q: %d variants", test.s, len(vs))
+		}
+		if got := forms(vs); fmt.Sprintf("%q", got) != fmt.Sprintf("%q", test.want) {
+			t.Errorf("%q: %q, want %q", test.s, got, test.want)
+		}
+	}
+
+	*ws = true
+	defer func() { *ws = false }()
+	if variants_count() != 8*6 {
+		t.Errorf("-ws: count %d", variants_count())
+	}
+
+	if err := parse_encodings("utf8"); err == nil {
+		t.Error("unknown encoding accepted")
+	}
+}
+
+func TestParseThreads(t *testing.T) {
+	const mb = 1 << 20
+	cpus := runtime.NumCPU()
+
+	tests := []struct {
+		spec              string
+		per_thread, avail int
+		want              int
+	}{
+		{"4", 0, 0, 4},
+		{"32", 256 * mb, 0, 32},
+		{"4", 256 * mb, 1024 * mb, 4},
+		{"8", 256 * mb, 1024 * mb, 4},
+		{"8", 256 * mb, 1000 * mb, 3},
+		{"1", 256 * mb, 256 * mb, 1},
+		{"auto", 0, 1024 * mb, cpus},
+		{"auto", 256 * mb, 0, cpus},
+		{"auto", 256 * mb, 256 * mb, 1},
+		{"auto", 1, 1 << 40, cpus},
+	}
+
+	for _, test := range tests {
+		if got := parse_threads(test.spec, test.per_thread, test.avail); got != test.want {
+			t.Errorf("%s, %d MB per thread, %d MB: %d, want %d", test.spec, test.per_thread/mb, test.avail/mb, got, test.want)
+		}
+	}
+
+	for _, spec := range []string{"0", "33", "-1", "a", ""} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%q accepted", spec)
+				}
+			}()
+			parse_threads(spec, 0, 0)
+		}()
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("no panic without memory for one thread")
+		}
+	}()
+	parse_threads("auto", 256*mb, 255*mb)
+}
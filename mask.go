@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+	"math"
+)
+
+// generator is a source of candidate passwords which knows their exact
+// number and can produce the i-th one.
+type generator interface {
+	total() int
+	at(i int) string
+}
+
+// pruner is a generator which knows the runs of the too long variants without
+// building every one of them.
+type pruner interface {
+	// at_max returns the i-th variant, or, if it is longer than max, "" and
+	// the number of the variants from i on which all are
+	at_max(i, max int) (string, int)
+}
+
+// at_max returns the i-th variant of any generator, see pruner
+func at_max(g generator, i, max int) (string, int) {
+	if p, ok := g.(pruner); ok {
+		return p.at_max(i, max)
+	}
+	return g.at(i), 0
+}
+
+// printable is the class used for '?' in masks: all the printable ASCII characters.
+var printable = func() []rune {
+	r := make([]rune, 0, 95)
+	for c := rune(0x20); c <= 0x7e; c++ {
+		r = append(r, c)
+	}
+	return r
+}()
+
+// mask is the password as the user remembers it, with the unknown or uncertain
+// characters replaced by '?' (any printable character) or by a [abc] class.
+// Only those positions are enumerated, the last one changes first.
+type mask struct {
+	positions [][]rune
+	count     int
+}
+
+func parse_class(r []rune, i int) ([]rune, int, error) {
+	class := make([]rune, 0)
+
+	add := func(c rune) {
+		for _, n := range class {
+			if n == c {
+				return
+			}
+		}
+		class = append(class, c)
+	}
+
+	for i++; i < len(r); i++ {
+		c := r[i]
+
+		switch {
+		case c == ']':
+			if len(class) == 0 {
+				return nil, i, errors.New("empty class in the mask")
+			}
+			return class, i, nil
+		case c == '\\' && i+1 < len(r):
+			i++
+			add(r[i])
+		case i+2 < len(r) && r[i+1] == '-' && r[i+2] != ']':
+			if r[i+2] < c {
+				return nil, i, errors.New("wrong range in the mask: " + string(r[i:i+3]))
+			}
+			for n := c; n <= r[i+2]; n++ {
+				add(n)
+			}
+			i += 2
+		default:
+			add(c)
+		}
+	}
+
+	return nil, i, errors.New("unterminated class in the mask")
+}
+
+func new_mask(s string, charset string) (*mask, error) {
+	m := &mask{count: 1}
+
+	any := printable
+	if charset != "" {
+		any = []rune(charset)
+	}
+
+	r := []rune(s)
+	for i := 0; i < len(r); i++ {
+		var p []rune
+
+		switch r[i] {
+		case '?':
+			p = any
+		case '[':
+			var err error
+			p, i, err = parse_class(r, i)
+			if err != nil {
+				return nil, err
+			}
+		case '\\':
+			if i+1 < len(r) {
+				i++
+			}
+			p = []rune{r[i]}
+		default:
+			p = []rune{r[i]}
+		}
+
+		if m.count > math.MaxInt64/len(p) {
+			return nil, errors.New("too many variants in the mask")
+		}
+		m.count *= len(p)
+		m.positions = append(m.positions, p)
+	}
+
+	if len(m.positions) == 0 {
+		return nil, errors.New("empty mask")
+	}
+
+	return m, nil
+}
+
+func (m *mask) total() int {
+	return m.count
+}
+
+func (m *mask) at(i int) string {
+	r := make([]rune, len(m.positions))
+
+	for k := len(m.positions) - 1; k >= 0; k-- {
+		p := m.positions[k]
+		r[k] = p[i%len(p)]
+		i /= len(p)
+	}
+
+	return string(r)
+}
+
+// unknowns returns the number of the positions which are not fixed.
+func (m *mask) unknowns() int {
+	n := 0
+	for _, p := range m.positions {
+		if len(p) > 1 {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"crypto/sha256"
+	"errors"
+	"math"
+	"math/bits"
+	"sort"
+	"strings"
+
+	"github.com/tyler-smith/go-bip39/wordlists"
+	"golang.org/x/text/unicode/norm"
+)
+
+// the BIP39 wordlists by name
+var bip39_wordlists = map[string][]string{
+	"english":             wordlists.English,
+	"chinese_simplified":  wordlists.ChineseSimplified,
+	"chinese_traditional": wordlists.ChineseTraditional,
+	"czech":               wordlists.Czech,
+	"french":              wordlists.French,
+	"italian":             wordlists.Italian,
+	"japanese":            wordlists.Japanese,
+	"korean":              wordlists.Korean,
+	"spanish":             wordlists.Spanish,
+}
+
+// bip39_list is a wordlist with the word numbers, the words are compared in NFKD
+type bip39_list struct {
+	name  string
+	words []string
+	index map[string]int
+}
+
+func new_bip39_list(name string) (*bip39_list, error) {
+	words, ok := bip39_wordlists[name]
+	if !ok {
+		return nil, errors.New("unknown wordlist: " + name)
+	}
+
+	l := &bip39_list{name: name, words: words, index: make(map[string]int, len(words))}
+	for i, w := range words {
+		l.index[norm.NFKD.String(w)] = i
+	}
+
+	return l, nil
+}
+
+// detect_wordlist returns the wordlist with the most of the words, english on
+// a tie, then the first by the name
+func detect_wordlist(words []string) *bip39_list {
+	best, best_n := "english", -1
+
+	names := make([]string, 0, len(bip39_wordlists))
+	for name := range bip39_wordlists {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		l, _ := new_bip39_list(name)
+
+		n := 0
+		for _, w := range words {
+			if _, ok := l.index[norm.NFKD.String(strings.TrimPrefix(w, "="))]; ok {
+				n++
+			}
+		}
+
+		if n > best_n || n == best_n && name == "english" {
+			best, best_n = name, n
+		}
+	}
+
+	l, _ := new_bip39_list(best)
+	return l
+}
+
+// checksum_ok checks the BIP39 checksum: the last n/3 bits of the n words are
+// the first bits of SHA256 of the rest
+func (l *bip39_list) checksum_ok(mnemonic string) bool {
+	words := strings.Fields(norm.NFKD.String(mnemonic))
+	n := len(words)
+	if n < 12 || n > 24 || n%3 != 0 {
+		return false
+	}
+
+	b := make([]byte, (n*11+7)/8)
+	for i, w := range words {
+		x, ok := l.index[w]
+		if !ok {
+			return false
+		}
+
+		for j := 0; j < 11; j++ {
+			if x&(1<<(10-j)) != 0 {
+				bit := i*11 + j
+				b[bit/8] |= 0x80 >> (bit % 8)
+			}
+		}
+	}
+
+	ent := n * 32 / 3 / 8 // entropy bytes
+	cs := n / 3           // checksum bits, at most 8
+	h := sha256.Sum256(b[:ent])
+
+	// with 24 words the checksum is the whole last byte
+	got := b[ent] >> (8 - cs)
+	want := h[0] >> (8 - cs)
+
+	return got == want
+}
+
+// word_distance is the edit distance of the words with the swaps of the
+// adjacent letters counted as one edit
+func word_distance(a, b string) int {
+	x, y := []rune(a), []rune(b)
+
+	d := make([][]int, len(x)+1)
+	for i := range d {
+		d[i] = make([]int, len(y)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+
+	for i := 1; i <= len(x); i++ {
+		for j := 1; j <= len(y); j++ {
+			cost := 1
+			if x[i-1] == y[j-1] {
+				cost = 0
+			}
+
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+
+			if i > 1 && j > 1 && x[i-1] == y[j-2] && x[i-2] == y[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+
+	return d[len(x)][len(y)]
+}
+
+// max_word_distance is how far a misspelled word may be from the right one
+const max_word_distance = 2
+
+// close_words returns the words of the list near w, the closest first. The
+// words sharing the first 4 letters with w go first: BIP39 words are unique by
+// them, and the wallets accept the 4 letters alone.
+func (l *bip39_list) close_words(w string) []string {
+	w = norm.NFKD.String(w)
+	r := []rune(w)
+
+	type near_word struct {
+		s string
+		d int
+	}
+	res := make([]near_word, 0)
+
+	for _, n := range l.words {
+		nr := []rune(norm.NFKD.String(n))
+
+		d := word_distance(w, string(nr))
+		if len(r) >= 4 && len(nr) >= 4 && string(r[:4]) == string(nr[:4]) {
+			d = 0
+		}
+
+		if d <= max_word_distance {
+			res = append(res, near_word{n, d})
+		}
+	}
+
+	sort.SliceStable(res, func(i, j int) bool { return res[i].d < res[j].d })
+
+	words := make([]string, len(res))
+	for i, n := range res {
+		words[i] = n.s
+	}
+	return words
+}
+
+// mnemonic_gen enumerates the mnemonics with every unknown ( ? ) word replaced
+// by every word of the list, and every word not in the list, or marked with ?
+// at the end, by the words close to it.
+type mnemonic_gen struct {
+	choices [][]string // the words to try at every position
+	count   int
+}
+
+func new_mnemonic_gen(words []string, l *bip39_list) (*mnemonic_gen, error) {
+	g := &mnemonic_gen{count: 1}
+
+	for _, w := range words {
+		var c []string
+
+		w = strings.TrimPrefix(w, "=") // the place is known anyway
+		_, known := l.index[norm.NFKD.String(w)]
+
+		switch {
+		case w == "?":
+			c = l.words
+
+		case strings.HasSuffix(w, "?"):
+			// the word as written first, then the close ones
+			base := strings.TrimSuffix(w, "?")
+			if _, ok := l.index[norm.NFKD.String(base)]; ok {
+				c = append(c, base)
+			}
+			for _, n := range l.close_words(base) {
+				if norm.NFKD.String(n) != norm.NFKD.String(base) {
+					c = append(c, n)
+				}
+			}
+
+		case known:
+			c = []string{w}
+
+		default:
+			c = l.close_words(w)
+		}
+
+		if len(c) == 0 {
+			return nil, errors.New("no " + l.name + " words close to " + w + ", mark it with ?")
+		}
+
+		g.choices = append(g.choices, c)
+		g.count = safe_mul(g.count, len(c))
+	}
+
+	return g, nil
+}
+
+// unknowns returns the number of the positions with more than one word
+func (g *mnemonic_gen) unknowns() int {
+	n := 0
+	for _, c := range g.choices {
+		if len(c) > 1 {
+			n++
+		}
+	}
+	return n
+}
+
+func (g *mnemonic_gen) total() int {
+	return g.count
+}
+
+func (g *mnemonic_gen) at(i int) string {
+	words := make([]string, len(g.choices))
+
+	for p := len(g.choices) - 1; p >= 0; p-- {
+		c := g.choices[p]
+		words[p] = c[i%len(c)]
+		i /= len(c)
+	}
+
+	return strings.Join(words, " ")
+}
+
+// mul_div returns a*b/c for the a*b divisible by c, even if a*b overflows
+func mul_div(a, b, c int) int {
+	hi, lo := bits.Mul64(uint64(a), uint64(b))
+	if hi >= uint64(c) {
+		panic("Too many variants. No way you have so much powerful computer...")
+	}
+
+	q, _ := bits.Div64(hi, lo, uint64(c))
+	if q > math.MaxInt64 {
+		panic("Too many variants. No way you have so much powerful computer...")
+	}
+	return int(q)
+}
+
+// mnemonic_perm enumerates the orders of the scrambled words. The words marked
+// with = at the start keep their places, and the same word repeated is not
+// swapped with itself.
+type mnemonic_perm struct {
+	fixed  []string // the word at every position, "" for the free ones
+	words  []string // the different free words
+	counts []int    // how many times every one of them
+	free   int
+	count  int
+}
+
+func new_mnemonic_perm(words []string, l *bip39_list) (*mnemonic_perm, error) {
+	g := &mnemonic_perm{fixed: make([]string, len(words)), count: 1}
+	seen := make(map[string]int)
+
+	for i, w := range words {
+		fixed := strings.HasPrefix(w, "=")
+		w = strings.TrimPrefix(w, "=")
+
+		if _, ok := l.index[norm.NFKD.String(w)]; !ok {
+			return nil, errors.New("not a " + l.name + " word: " + w + ", all the words must be known to find the order")
+		}
+
+		if fixed {
+			g.fixed[i] = w
+			continue
+		}
+
+		j, ok := seen[w]
+		if !ok {
+			j = len(g.words)
+			seen[w] = j
+			g.words = append(g.words, w)
+			g.counts = append(g.counts, 0)
+		}
+		g.counts[j]++
+		g.free++
+
+		// the number of the different orders of the free words so far
+		g.count = mul_div(g.count, g.free, g.counts[j])
+	}
+
+	return g, nil
+}
+
+func (g *mnemonic_perm) total() int {
+	return g.count
+}
+
+func (g *mnemonic_perm) at(i int) string {
+	counts := make([]int, len(g.counts))
+	copy(counts, g.counts)
+
+	res := make([]string, len(g.fixed))
+	n, total := g.free, g.count
+
+	for p, w := range g.fixed {
+		if w != "" {
+			res[p] = w
+			continue
+		}
+
+		// the orders with the j-th word here are counts[j]/n of all
+		for j, c := range counts {
+			if c == 0 {
+				continue
+			}
+
+			sub := mul_div(total, c, n)
+			if i < sub {
+				res[p] = g.words[j]
+				counts[j]--
+				total = sub
+				n--
+				break
+			}
+			i -= sub
+		}
+	}
+
+	return strings.Join(res, " ")
+}
@@ -0,0 +1,150 @@
+package main
+
+// list is a generator over already prepared variants.
+type list []string
+
+func (l list) total() int {
+	return len(l)
+}
+
+func (l list) at(i int) string {
+	return l[i]
+}
+
+// edits returns all the strings one edit away from s: a printable character
+// inserted at any position, a character deleted or replaced, or two adjacent
+// characters swapped.
+func edits(s string) []string {
+	r := []rune(s)
+	res := make([]string, 0, (2*len(r)+1)*len(printable)+2*len(r))
+
+	for i := 0; i <= len(r); i++ {
+		for _, c := range printable {
+			res = append(res, string(r[:i])+string(c)+string(r[i:]))
+		}
+	}
+
+	for i := 0; i < len(r); i++ {
+		res = append(res, string(r[:i])+string(r[i+1:]))
+
+		for _, c := range printable {
+			if c != r[i] {
+				res = append(res, string(r[:i])+string(c)+string(r[i+1:]))
+			}
+		}
+
+		if i+1 < len(r) && r[i] != r[i+1] {
+			sw := make([]rune, len(r))
+			copy(sw, r)
+			sw[i], sw[i+1] = sw[i+1], sw[i]
+			res = append(res, string(sw))
+		}
+	}
+
+	return res
+}
+
+// near_gen enumerates every variant within the edit distance k from any of the
+// remembered passwords, without duplicates and ordered by the distance.
+//
+// The variants are generated one distance at a time. An edit is undone by
+// another edit, so it changes the distance by one at most: the variants of
+// the next distance can only repeat the last two, and the older distances are
+// dropped from the memory.
+type near_gen struct {
+	passwords []string // the distance 0
+	sizes     []int    // the number of the variants at every distance
+	count     int
+
+	dist   int        // the distance of the last level generated
+	levels [][]string // the last levels, up to dist
+}
+
+func new_near(passwords []string, k int) *near_gen {
+	g := &near_gen{}
+
+	seen := make(map[string]bool)
+	for _, p := range passwords {
+		if !seen[p] {
+			seen[p] = true
+			g.passwords = append(g.passwords, p)
+		}
+	}
+
+	// the counting pass keeps the last levels for the run
+	g.reset()
+	g.sizes = []int{len(g.passwords)}
+	for g.dist < k {
+		g.next()
+		g.sizes = append(g.sizes, len(g.levels[len(g.levels)-1]))
+	}
+
+	for _, n := range g.sizes {
+		g.count = safe_sum(g.count, n)
+	}
+
+	return g
+}
+
+func (g *near_gen) reset() {
+	g.dist = 0
+	g.levels = [][]string{g.passwords}
+}
+
+// next generates the variants of the next distance
+func (g *near_gen) next() {
+	if len(g.levels) > 2 {
+		g.levels = g.levels[1:]
+	}
+
+	seen := make(map[string]bool)
+	for _, l := range g.levels {
+		for _, s := range l {
+			seen[s] = true
+		}
+	}
+
+	next := make([]string, 0)
+	for _, s := range g.levels[len(g.levels)-1] {
+		for _, e := range edits(s) {
+			if !seen[e] {
+				seen[e] = true
+				next = append(next, e)
+			}
+		}
+	}
+
+	g.levels = append(g.levels, next)
+	g.dist++
+}
+
+// level returns the variants at the distance d, generating them again from
+// the start if d is already dropped
+func (g *near_gen) level(d int) []string {
+	if d == 0 {
+		return g.passwords
+	}
+
+	if d <= g.dist-len(g.levels) {
+		g.reset()
+	}
+	for g.dist < d {
+		g.next()
+	}
+
+	return g.levels[len(g.levels)-1-(g.dist-d)]
+}
+
+func (g *near_gen) total() int {
+	return g.count
+}
+
+func (g *near_gen) at(i int) string {
+	d := 0
+	for i >= g.sizes[d] {
+		i -= g.sizes[d]
+		d++
+	}
+
+	return g.level(d)[i]
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+const shuffle_rounds = 6
+
+// shuffle is a keyed pseudorandom permutation of 0..n-1. It is a balanced
+// Feistel network over the smallest even power of two not less than n, and
+// the values out of 0..n-1 are walked through the network again until they
+// get inside ( cycle walking ), so it stays a bijection.
+type shuffle struct {
+	n    uint64
+	half uint // number of the bits in the half of the Feistel network
+	key  []byte
+}
+
+func new_shuffle(n int, key string) *shuffle {
+	s := &shuffle{n: uint64(n), half: 1}
+	for s.half < 32 && uint64(1)<<(2*s.half) < s.n {
+		s.half++
+	}
+
+	k := sha256.Sum256([]byte("ethcracker order: " + key))
+	s.key = k[:]
+
+	return s
+}
+
+// round is the Feistel round function
+func (s *shuffle) round(r int, x uint64) uint64 {
+	var b [9]byte
+	b[0] = byte(r)
+	binary.BigEndian.PutUint64(b[1:], x)
+
+	m := hmac.New(sha256.New, s.key)
+	m.Write(b[:])
+
+	return binary.BigEndian.Uint64(m.Sum(nil)) & (uint64(1)<<s.half - 1)
+}
+
+func (s *shuffle) feistel(x uint64) uint64 {
+	mask := uint64(1)<<s.half - 1
+	l, r := x>>s.half, x&mask
+
+	for i := 0; i < shuffle_rounds; i++ {
+		l, r = r, l^s.round(i, r)
+	}
+
+	return l<<s.half | r
+}
+
+// at returns the place of i in the permutation
+func (s *shuffle) at(i int) int {
+	x := s.feistel(uint64(i))
+	for x >= s.n {
+		x = s.feistel(x)
+	}
+	return int(x)
+}
+
+// shuffled visits every variant of the generator exactly once, but in the
+// keyed pseudorandom order, so a partial run samples the whole space evenly.
+type shuffled struct {
+	gen generator
+	s   *shuffle
+}
+
+func new_shuffled(g generator, key string) *shuffled {
+	return &shuffled{gen: g, s: new_shuffle(g.total(), key)}
+}
+
+func (g *shuffled) total() int {
+	return g.gen.total()
+}
+
+func (g *shuffled) at(i int) string {
+	return g.gen.at(g.s.at(i))
+}
+
+// shard is the i-th of n disjoint slices of the variants, so n processes can
+// share the work without any coordination.
+type shard struct {
+	gen   generator
+	from  int
+	count int
+}
+
+// new_shard parses "i/n" ( 1 <= i <= n ) and cuts the i-th slice of the generator
+func new_shard(g generator, spec string) (*shard, error) {
+	parts := strings.Split(spec, "/")
+	if len(parts) != 2 {
+		return nil, errors.New("wrong shard, expected i/n: " + spec)
+	}
+
+	i, err1 := strconv.Atoi(parts[0])
+	n, err2 := strconv.Atoi(parts[1])
+	if err1 != nil || err2 != nil || n < 1 || i < 1 || i > n {
+		return nil, errors.New("wrong shard, expected i/n with 1 <= i <= n: " + spec)
+	}
+	i--
+
+	base, rem := g.total()/n, g.total()%n
+
+	s := &shard{gen: g, from: i*base + i, count: base}
+	if i >= rem {
+		s.from = i*base + rem
+	} else {
+		s.count++
+	}
+
+	return s, nil
+}
+
+func (g *shard) total() int {
+	return g.count
+}
+
+func (g *shard) at(i int) string {
+	return g.gen.at(g.from + i)
+}
+
+func (g *shard) at_max(i, max int) (string, int) {
+	s, k := at_max(g.gen, g.from+i, max)
+	return s, min(k, g.count-i)
+}
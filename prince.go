@@ -0,0 +1,106 @@
+package main
+
+// prince builds the variants by chaining 1..elems words from one wordlist
+// ( the PRINCE attack ). The shorter variants go first, and for the same
+// length the chains with fewer words go first.
+type prince struct {
+	by_len  [][]string // the words by their length
+	elems   int
+	min_len int
+
+	chains [][]int // chains[k][n]: number of the chains of k words with the total length n
+	count  int
+}
+
+func new_prince(words []string, elems, min_elem, max_elem, min_len, max_len int) *prince {
+	if max_elem > max_len {
+		max_elem = max_len
+	}
+
+	p := &prince{
+		by_len:  make([][]string, max_elem+1),
+		elems:   elems,
+		min_len: min_len,
+	}
+
+	seen := make(map[string]bool)
+	for _, w := range words {
+		if len(w) < min_elem || len(w) > max_elem || len(w) == 0 || seen[w] {
+			continue
+		}
+		seen[w] = true
+		p.by_len[len(w)] = append(p.by_len[len(w)], w)
+	}
+
+	p.chains = make([][]int, elems+1)
+	for k := range p.chains {
+		p.chains[k] = make([]int, max_len+1)
+	}
+	p.chains[0][0] = 1
+
+	for k := 1; k <= elems; k++ {
+		for n := 1; n <= max_len; n++ {
+			for l := 1; l <= n && l < len(p.by_len); l++ {
+				p.chains[k][n] = safe_sum(p.chains[k][n], safe_mul(len(p.by_len[l]), p.chains[k-1][n-l]))
+			}
+		}
+	}
+
+	for n := min_len; n <= max_len; n++ {
+		for k := 1; k <= elems; k++ {
+			p.count = safe_sum(p.count, p.chains[k][n])
+		}
+	}
+
+	return p
+}
+
+// words returns the number of the different words used
+func (p *prince) words() int {
+	n := 0
+	for _, w := range p.by_len {
+		n += len(w)
+	}
+	return n
+}
+
+func (p *prince) total() int {
+	return p.count
+}
+
+func (p *prince) at(i int) string {
+	n, k := p.min_len, 1
+	if n < 0 {
+		n = 0
+	}
+
+	for i >= p.chains[k][n] {
+		i -= p.chains[k][n]
+		if k++; k > p.elems {
+			k = 1
+			n++
+		}
+	}
+
+	s := ""
+	for ; k > 0; k-- {
+		for l := 1; l < len(p.by_len); l++ {
+			if l > n {
+				panic("prince: index out of range")
+			}
+
+			rest := p.chains[k-1][n-l]
+			if w := len(p.by_len[l]) * rest; i >= w {
+				i -= w
+				continue
+			}
+
+			s += p.by_len[l][i/rest]
+			i %= rest
+			n -= l
+			break
+		}
+	}
+
+	return s
+}
@@ -0,0 +1,628 @@
+package main
+
+import (
+	"math"
+	"strings"
+)
+
+// template_gen enumerates the variants of the template file.
+//
+// The lines are grouped into blocks: every fixed line ( ~k, or any line with
+// -keep_order unless it has ~p ) is a block of its own, and the neighbouring
+// permutable lines form one block. The tokens selected in a block are used in
+// any order ( or in the orders at most near_order adjacent swaps away from the
+// file order ), the blocks themselves always keep the file order.
+//
+// A line with ~rN gives a sequence of up to N different tokens ( ~RN: the
+// same token can repeat ), which stays together in the permutations.
+//
+// A line with conditions ( ~?name, ~?!name, ~?name=token ) is used only when
+// all of them are true. With ~a it is used exactly when they are true.
+//
+// The variants are numbered, so the i-th one is computed directly: the
+// earlier lines are the more significant "digits", and the permutation of a
+// block comes right after its last line.
+type template_gen struct {
+	lines      [][]string
+	flags      []TEMP_FLAGS
+	pieces     []int   // number of the ways to use the line
+	classes    [][]int // the ways to use the line grouped by the referred tokens: [ end of class 1, end of class 2, ..., pieces ]
+	last       []bool  // the line closes its block
+	near_order int
+
+	slot   []int            // position of the line in the state context, -1 if no condition needs it
+	keep   []int            // the last line which needs the context slot of the line
+	checks [][]template_dep // conditions checked right after the line
+
+	memo  map[template_state]int
+	plain [][]int // the memo of the states with no context, -1 if not known
+	perms map[[2]int]int
+	facts []int // the factorials up to the number of the lines, while they fit
+	count int
+	empty bool // the variant with no lines used at all is counted, but never tried
+}
+
+type template_state struct {
+	line int
+	used int    // number of the lines used so far in the current block
+	ctx  string // classes chosen on the lines the conditions need
+}
+
+// template_dep is a condition of the line on the line ref, or, with always,
+// the rule that the ~a line is used when all its conditions are true.
+type template_dep struct {
+	line   int
+	ref    int
+	class  int // 0: the line ref is used at all
+	not    bool
+	always bool
+}
+
+const no_class = 0xff
+
+func safe_mul(a, b int) int {
+	if a != 0 && b > math.MaxInt64/a {
+		panic("Too many variants. No way you have so much powerful computer...")
+	}
+	return a * b
+}
+
+func safe_sum(a, b int) int {
+	if a > math.MaxInt64-b {
+		panic("Too many variants. No way you have so much powerful computer...")
+	}
+	return a + b
+}
+
+func new_template_gen(lines [][]string, flags []TEMP_FLAGS, keep_order bool, near_order int) *template_gen {
+	g := &template_gen{
+		lines:      lines,
+		flags:      flags,
+		pieces:     make([]int, len(lines)),
+		classes:    make([][]int, len(lines)),
+		last:       make([]bool, len(lines)),
+		near_order: near_order,
+		slot:       make([]int, len(lines)),
+		keep:       make([]int, len(lines)),
+		checks:     make([][]template_dep, len(lines)),
+		memo:       make(map[template_state]int),
+		perms:      make(map[[2]int]int),
+	}
+
+	fixed := func(i int) bool {
+		return flags[i].Keep || (keep_order && !flags[i].Permute)
+	}
+
+	for i := range lines {
+		g.last[i] = fixed(i) || i == len(lines)-1 || fixed(i+1)
+
+		for c := 1; c <= flags[i].Repeat; c++ {
+			g.pieces[i] = safe_sum(g.pieces[i], sequences(len(lines[i]), c, flags[i].Same))
+		}
+	}
+
+	g.plain = make([][]int, len(lines))
+	for j := range g.plain {
+		g.plain[j] = make([]int, len(lines)+1)
+		for u := range g.plain[j] {
+			g.plain[j][u] = -1
+		}
+	}
+
+	// up to 20!, a longer block is counted by perm_count and fails only if
+	// it is really permuted
+	g.facts = []int{1}
+	for m := 1; m <= len(lines) && g.facts[m-1] <= math.MaxInt64/m; m++ {
+		g.facts = append(g.facts, g.facts[m-1]*m)
+	}
+
+	g.resolve_deps()
+
+	g.empty = g.valid_empty()
+	g.count = g.completions(template_state{0, 0, g.no_ctx()})
+
+	return g
+}
+
+func (g *template_gen) slots() int {
+	n := 0
+	for _, s := range g.slot {
+		if s >= 0 {
+			n++
+		}
+	}
+	return n
+}
+
+func (g *template_gen) no_ctx() string {
+	return strings.Repeat(string([]byte{no_class}), g.slots())
+}
+
+// resolve_deps finds the lines the conditions refer to, groups the referred
+// tokens into the classes and decides where every condition is checked.
+func (g *template_gen) resolve_deps() {
+	names := make(map[string]int)
+	for i, f := range g.flags {
+		if f.Name != "" {
+			if _, ok := names[f.Name]; ok {
+				panic("Duplicate line name: " + f.Name)
+			}
+			names[f.Name] = i
+		}
+	}
+
+	marks := make([][]string, len(g.lines))
+	deps := make([]template_dep, 0)
+
+	for i, f := range g.flags {
+		for _, c := range f.Conds {
+			ref, ok := names[c.Line]
+			if !ok {
+				panic("Unknown line name in the condition: " + c.Line)
+			}
+			if ref == i {
+				panic("The line refers to itself: " + c.Line)
+			}
+
+			d := template_dep{line: i, ref: ref, not: c.Not}
+
+			if c.Token != "" {
+				if g.flags[ref].Repeat > 1 {
+					panic("Can not refer to a token of the ~r line: " + c.Line)
+				}
+
+				t := strings.ToLower(c.Token)
+				for k, m := range marks[ref] {
+					if m == t {
+						d.class = k + 1
+					}
+				}
+				if d.class == 0 {
+					marks[ref] = append(marks[ref], t)
+					d.class = len(marks[ref])
+				}
+			}
+
+			deps = append(deps, d)
+		}
+	}
+
+	// the tokens of the same class go one after another, the rest at the end
+	for i := range g.lines {
+		if len(marks[i]) == 0 {
+			g.classes[i] = []int{g.pieces[i]}
+			continue
+		}
+
+		sorted := make([]string, 0, len(g.lines[i]))
+		g.classes[i] = make([]int, 0, len(marks[i])+1)
+
+		for _, m := range marks[i] {
+			n := len(sorted)
+			for _, t := range g.lines[i] {
+				if strings.ToLower(t) == m {
+					sorted = append(sorted, t)
+				}
+			}
+
+			if len(sorted) == n {
+				panic("No token " + m + " on the line " + g.flags[i].Name)
+			}
+			g.classes[i] = append(g.classes[i], len(sorted))
+		}
+
+		for _, t := range g.lines[i] {
+			found := false
+			for _, m := range marks[i] {
+				found = found || strings.ToLower(t) == m
+			}
+			if !found {
+				sorted = append(sorted, t)
+			}
+		}
+
+		g.lines[i] = sorted
+		g.classes[i] = append(g.classes[i], len(sorted))
+
+		if len(g.classes[i]) >= no_class {
+			panic("Too many tokens referred on the line " + g.flags[i].Name)
+		}
+	}
+
+	for i := range g.slot {
+		g.slot[i] = -1
+		g.keep[i] = -1
+	}
+
+	// the ~a rule of a line is checked after all its conditions
+	always := make(map[int]int)
+
+	for _, d := range deps {
+		at := d.line
+		if d.ref > at {
+			at = d.ref
+		}
+
+		g.checks[at] = append(g.checks[at], d)
+
+		for _, n := range []int{d.line, d.ref} {
+			if g.slot[n] < 0 {
+				g.slot[n] = g.slots()
+			}
+			if at > g.keep[n] {
+				g.keep[n] = at
+			}
+		}
+
+		if g.flags[d.line].UseAlways && at > always[d.line] {
+			always[d.line] = at
+		}
+	}
+
+	for n, at := range always {
+		g.checks[at] = append(g.checks[at], template_dep{line: n, always: true})
+	}
+}
+
+// holds tells if the condition d is true with the classes in ctx
+func (g *template_gen) holds(d template_dep, ctx string) bool {
+	c := ctx[g.slot[d.ref]]
+
+	switch {
+	case d.not:
+		return c == 0
+	case d.class > 0:
+		return int(c) == d.class
+	}
+	return c != 0
+}
+
+// valid checks the conditions known after the decision on the line j
+func (g *template_gen) valid(j int, ctx string) bool {
+	for _, d := range g.checks[j] {
+		used := ctx[g.slot[d.line]] != 0
+
+		if d.always {
+			all := true
+			for _, a := range g.checks {
+				for _, c := range a {
+					if c.line == d.line && !c.always {
+						all = all && g.holds(c, ctx)
+					}
+				}
+			}
+
+			if all && !used {
+				return false
+			}
+		} else if used && !g.holds(d, ctx) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// can_skip tells if the line can be not used at all
+func (g *template_gen) can_skip(j int) bool {
+	return !g.flags[j].UseAlways || len(g.flags[j].Conds) > 0
+}
+
+func (g *template_gen) valid_empty() bool {
+	ctx := g.no_ctx()
+
+	for j := range g.lines {
+		if !g.can_skip(j) {
+			return false
+		}
+
+		var ok bool
+		if ctx, ok = g.choose(j, 0, ctx); !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// choose returns the context after the line j is used with the class c
+// ( 0: not used ), or false if some condition is broken.
+func (g *template_gen) choose(j int, c int, ctx string) (string, bool) {
+	if g.slot[j] < 0 {
+		return ctx, g.valid(j, ctx)
+	}
+
+	b := []byte(ctx)
+	b[g.slot[j]] = byte(c)
+	ctx = string(b)
+
+	return ctx, g.valid(j, ctx)
+}
+
+// forget clears the context of the lines not needed after the line j,
+// so the states differing only by them are counted once.
+func (g *template_gen) forget(j int, ctx string) string {
+	if ctx == "" {
+		return ctx // no conditions
+	}
+
+	var b []byte
+
+	for n, s := range g.slot {
+		if s >= 0 && g.keep[n] == j {
+			if b == nil {
+				b = []byte(ctx)
+			}
+			b[s] = no_class
+		}
+	}
+
+	if b == nil {
+		return ctx
+	}
+	return string(b)
+}
+
+// class_size returns the number of the ways to use the line j with the class c
+func (g *template_gen) class_size(j, c int) int {
+	switch c {
+	case 0:
+		return 1
+	case 1:
+		return g.classes[j][0]
+	}
+	return g.classes[j][c-1] - g.classes[j][c-2]
+}
+
+// sequences returns the number of the sequences of c tokens out of n
+func sequences(n, c int, same bool) int {
+	r := 1
+	for k := 0; k < c; k++ {
+		if same {
+			r = safe_mul(r, n)
+		} else {
+			r = safe_mul(r, n-k)
+		}
+	}
+	return r
+}
+
+// piece returns the t-th way to use the line j: the shorter sequences first
+func (g *template_gen) piece(j, t int) string {
+	tokens := g.lines[j]
+	f := g.flags[j]
+
+	if f.Repeat == 1 {
+		return tokens[t]
+	}
+
+	c := 1
+	for ; c < f.Repeat; c++ {
+		n := sequences(len(tokens), c, f.Same)
+		if t < n {
+			break
+		}
+		t -= n
+	}
+
+	rest := make([]string, len(tokens))
+	copy(rest, tokens)
+
+	s := ""
+	for k := 0; k < c; k++ {
+		w := sequences(len(rest), c-k-1, true)
+		if !f.Same {
+			w = sequences(len(rest)-1, c-k-1, false)
+		}
+		d := t / w
+		t %= w
+
+		s += rest[d]
+		if !f.Same {
+			rest = append(rest[:d], rest[d+1:]...)
+		}
+	}
+
+	return s
+}
+
+// blocks returns the number of the line blocks
+func (g *template_gen) blocks() int {
+	n := 0
+	for _, b := range g.last {
+		if b {
+			n++
+		}
+	}
+	return n
+}
+
+// perm_count returns the number of the permutations of m items having at
+// most k inversions, i.e. at most k adjacent swaps away from the original
+// order ( k < 0 means no limit ). Those are the Lehmer codes with the sum of
+// the digits not greater than k.
+func (g *template_gen) perm_count(m, k int) int {
+	if m <= 1 {
+		return 1
+	}
+
+	if k < 0 || k > m*(m-1)/2 {
+		k = m * (m - 1) / 2
+	}
+
+	if m < len(g.facts) && k == m*(m-1)/2 {
+		return g.facts[m] // any order
+	}
+
+	key := [2]int{m, k}
+	if c, ok := g.perms[key]; ok {
+		return c
+	}
+
+	c := 0
+	for d := 0; d < m && d <= k; d++ {
+		c = safe_sum(c, g.perm_count(m-1, k-d))
+	}
+
+	g.perms[key] = c
+	return c
+}
+
+// permutation appends the p-th ( in the lexicographic order ) permutation of
+// the items having at most k inversions to b. The items are used up.
+func (g *template_gen) permutation(b *strings.Builder, rest []string, p, k int) {
+	if k < 0 {
+		k = len(rest) * len(rest)
+	}
+
+	for len(rest) > 0 {
+		for d := 0; d < len(rest) && d <= k; d++ {
+			w := g.perm_count(len(rest)-1, k-d)
+			if p < w {
+				b.WriteString(rest[d])
+				rest = append(rest[:d], rest[d+1:]...)
+				k -= d
+				break
+			}
+			p -= w
+		}
+	}
+}
+
+// after returns the number of the variants following the decision on the line
+// s.line, with s.used lines used in its block ( including this one ).
+func (g *template_gen) after(s template_state) int {
+	ctx := g.forget(s.line, s.ctx)
+
+	if g.last[s.line] {
+		return safe_mul(g.perm_count(s.used, g.near_order), g.completions(template_state{s.line + 1, 0, ctx}))
+	}
+
+	return g.completions(template_state{s.line + 1, s.used, ctx})
+}
+
+// completions returns the number of the variants of the lines starting from s.line
+func (g *template_gen) completions(s template_state) int {
+	if s.line == len(g.lines) {
+		return 1
+	}
+
+	// without conditions the state is just the line and the lines used
+	if s.ctx == "" && g.plain[s.line][s.used] >= 0 {
+		return g.plain[s.line][s.used]
+	}
+	if c, ok := g.memo[s]; ok {
+		return c
+	}
+
+	c := 0
+	for cl := 0; cl <= len(g.classes[s.line]); cl++ {
+		if cl == 0 && !g.can_skip(s.line) {
+			continue
+		}
+
+		ctx, ok := g.choose(s.line, cl, s.ctx)
+		if !ok {
+			continue
+		}
+
+		used := s.used
+		if cl > 0 {
+			used++
+		}
+
+		c = safe_sum(c, safe_mul(g.class_size(s.line, cl), g.after(template_state{s.line, used, ctx})))
+	}
+
+	if s.ctx == "" {
+		g.plain[s.line][s.used] = c
+	} else {
+		g.memo[s] = c
+	}
+	return c
+}
+
+func (g *template_gen) total() int {
+	if g.empty {
+		return g.count - 1
+	}
+	return g.count
+}
+
+func (g *template_gen) at(i int) string {
+	s, _ := g.at_max(i, math.MaxInt)
+	return s
+}
+
+// at_max is at, but as soon as the lines chosen so far are longer than max it
+// returns the number of the variants from i on sharing them, all too long.
+func (g *template_gen) at_max(i, max int) (string, int) {
+	if g.empty {
+		i++ // skip the variant with nothing selected
+	}
+
+	var s strings.Builder
+	length := 0 // bytes chosen so far, the order does not change it
+	block := make([]string, 0, len(g.lines))
+	st := template_state{0, 0, g.no_ctx()}
+
+	for j := range g.lines {
+		first := 0 // the first way to use the line in the class
+
+		for cl := 0; cl <= len(g.classes[j]); cl++ {
+			if cl == 0 && !g.can_skip(j) {
+				continue
+			}
+
+			size := g.class_size(j, cl)
+			if cl == 0 {
+				size = 0 // does not move the first way
+			}
+
+			ctx, ok := g.choose(j, cl, st.ctx)
+			if !ok {
+				first += size
+				continue
+			}
+
+			used := st.used
+			if cl > 0 {
+				used++
+			}
+
+			w := g.after(template_state{j, used, ctx})
+			if n := g.class_size(j, cl) * w; i >= n {
+				i -= n
+				first += size
+				continue
+			}
+
+			if cl > 0 {
+				p := g.piece(j, first+i/w)
+				block = append(block, p)
+				length += len(p)
+			}
+			i %= w
+
+			if length > max {
+				return "", w - i
+			}
+
+			st.ctx = g.forget(j, ctx)
+			st.used = used
+			break
+		}
+
+		if g.last[j] {
+			w := g.completions(template_state{j + 1, 0, st.ctx})
+			s.Grow(length - s.Len())
+			g.permutation(&s, block, i/w, g.near_order)
+			i %= w
+
+			block = block[:0]
+			st.used = 0
+		}
+	}
+
+	return s.String(), 0
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+const max_threads = 32
+
+// available_memory returns MemAvailable of /proc/meminfo in bytes, or 0 if
+// it is unknown
+func available_memory() int {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "MemAvailable:" {
+			kb, err := strconv.Atoi(fields[1])
+			if err != nil {
+				return 0
+			}
+			return kb * 1024
+		}
+	}
+
+	return 0
+}
+
+// parse_threads returns the number of threads for -threads N or auto. With
+// auto it is one per CPU, as many as fit into avail bytes of memory, when one
+// thread needs per_thread bytes; N is cut down to what fits.
+func parse_threads(spec string, per_thread, avail int) int {
+	n := runtime.NumCPU()
+
+	if spec != "auto" {
+		var err error
+		n, err = strconv.Atoi(spec)
+		if err != nil || n < 1 || n > max_threads {
+			panic("Wrong number of threads: " + spec)
+		}
+	}
+
+	if per_thread == 0 || avail == 0 {
+		return n
+	}
+
+	fit := avail / per_thread
+	if fit < 1 {
+		panic("Not enough memory for even one thread: " + strconv.Itoa(per_thread>>20) +
+			" MB needed, " + strconv.Itoa(avail>>20) + " MB available")
+	}
+
+	if n > fit {
+		if spec != "auto" {
+			println("WARNING: not enough memory for", n, "threads, using", fit)
+		}
+		n = fit
+	}
+
+	return n
+}
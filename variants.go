@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/unicode/norm"
+)
+
+// form is one of the forms of the password to try
+type form struct {
+	s   string // the bytes to try, not always UTF-8
+	bad bool   // the password can not be encoded
+}
+
+// encoders are the alternate byte encodings of the non-ASCII passwords
+var encoders = map[string]func(s string) (string, error){
+	"nfc":     func(s string) (string, error) { return norm.NFC.String(s), nil },
+	"nfd":     func(s string) (string, error) { return norm.NFD.String(s), nil },
+	"cp1251":  charset(charmap.Windows1251),
+	"cp1252":  charset(charmap.Windows1252),
+	"latin1":  charset(charmap.ISO8859_1),
+	"utf16le": charset(unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)),
+}
+
+func charset(e encoding.Encoding) func(s string) (string, error) {
+	return func(s string) (string, error) {
+		return e.NewEncoder().String(s)
+	}
+}
+
+var encodings []func(s string) (string, error)
+
+// parse_encodings parses the comma separated list of -enc
+func parse_encodings(list string) error {
+	for _, n := range strings.Split(list, ",") {
+		e, ok := encoders[strings.TrimSpace(strings.ToLower(n))]
+		if !ok {
+			return errors.New("unknown encoding: " + n)
+		}
+		encodings = append(encodings, e)
+	}
+	return nil
+}
+
+// variants returns the forms of the password to try: the password itself and,
+// with -ws, the whitespace variants, every one as is and in the -enc encodings.
+// The result always has the same length, the repeated forms are skipped as
+// duplicates.
+func variants(s string) []form {
+	ws_forms := []string{s}
+
+	if *ws {
+		// scripted --password files and copy-paste often add those
+		ws_forms = []string{
+			s,
+			strings.TrimSpace(s),
+			s + "\n",
+			s + "\r\n",
+			s + " ",
+			s + " \n",
+			" " + s,
+			" " + s + " ",
+		}
+	}
+
+	res := make([]form, 0, len(ws_forms)*(len(encodings)+1))
+
+	for _, w := range ws_forms {
+		res = append(res, form{s: w})
+
+		for _, e := range encodings {
+			b, err := e(w)
+			res = append(res, form{s: b, bad: err != nil})
+		}
+	}
+
+	return res
+}
+
+// variants_count returns the number of the forms of every password
+func variants_count() int {
+	return len(variants(""))
+}